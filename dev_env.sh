@@ -12,5 +12,85 @@ export REDIS_POOL_SIZE=100
 export JWT_RSA_KEY_LOCATION='/opt/meow/private_key.pem'
 export JWT_OLD_RSA_KEY_LOCATION=''
 
-#two hours
-export JWT_TOKEN_LIFETIME=120
+#fifteen minutes
+export JWT_TOKEN_LIFETIME=15
+#thirty days
+export REFRESH_TOKEN_LIFETIME=43200
+
+#use different values in each environment, thus the tokens cannot be used across the environments
+export JWT_ISSUER='meow-dev'
+export JWT_AUDIENCE='meow-api-dev'
+export JWT_CLOCK_SKEW=30
+
+#renew the token after half of its lifetime, for at most twelve hours since the login
+export JWT_RENEW_PERCENT=50
+export JWT_MAX_SESSION_LIFETIME=720
+
+#generated by "go run tools/devca/main.go", set TLS_CERT_FILE to empty string for plain http
+export TLS_CERT_FILE=''
+export TLS_KEY_FILE='/opt/meow/tls/server.key'
+export TLS_CLIENT_CA_FILE='/opt/meow/tls/ca.crt'
+export SERVICE_PRINCIPALS='billing.internal=eeee1df4-9fae-4e32-98c1-88f850a00003/cat:read'
+
+export CLIENT_IP_HEADER=''
+
+export COOKIE_SECURE=false
+export COOKIE_SAME_SITE='strict'
+export COOKIE_DOMAIN=''
+export CSRF_SECRET='meow_csrf_secret_for_development_only'
+
+export LOGIN_MAX_ATTEMPTS=5
+export LOGIN_MAX_ATTEMPTS_PER_IP=50
+export LOGIN_LOCKOUT_PERIOD=30
+#one hour
+export LOGIN_MAX_LOCKOUT_PERIOD=3600
+
+export PASSWORD_RESET_URL='http://localhost:3000/password-reset'
+export PASSWORD_RESET_TOKEN_LIFETIME=30
+export PASSWORD_RESET_MAX_REQUESTS=3
+export PASSWORD_RESET_MAX_REQUESTS_PER_IP=20
+
+export EMAIL_VERIFY_URL='http://localhost:3000/verify'
+#three days
+export EMAIL_VERIFY_TOKEN_LIFETIME=4320
+
+export EMAIL_CHANGE_URL='http://localhost:3000/email-change'
+#one day
+export EMAIL_CHANGE_TOKEN_LIFETIME=1440
+
+#the password digests of the other algorithm, or of the other parameters, are upgraded when the user logs in
+export PASSWORD_HASHER='argon2id'
+export BCRYPT_COST=12
+#three passes over 64 MiB
+export ARGON2_TIME=3
+export ARGON2_MEMORY=65536
+export ARGON2_THREADS=2
+
+export PASSWORD_MIN_LENGTH=10
+export PASSWORD_MIN_SCORE=3
+#generated by "go run tools/breachlist/main.go", see remarks.txt
+export BREACHED_PASSWORD_DIR='/opt/meow/breached'
+
+export IMPERSONATION_TOKEN_LIFETIME=10
+
+export SUDO_WINDOW=10
+
+export EXPORT_DIR='/opt/meow/exports'
+#seven days
+export EXPORT_ARCHIVE_LIFETIME=10080
+
+export TOTP_ISSUER='Meow'
+
+#the mock identity provider in tools/mockidp, set OIDC_ISSUER to empty string to disable the oidc login
+export OIDC_ISSUER='http://localhost:9090'
+export OIDC_CLIENT_ID='meow'
+export OIDC_CLIENT_SECRET='meow_secret'
+export OIDC_REDIRECT_URL='http://localhost:8080/v1/auth/oidc/callback'
+export OIDC_FRONTEND_URL='http://localhost:3000/oidc'
+
+export MAIL_SENDER='file'
+export MAIL_FROM='no-reply@meow.com'
+export MAIL_FILE_DIR='/tmp/meow_mail'
+export SMTP_ADDR='localhost:25'
+export SMTP_USERNAME=''
+export SMTP_PASSWORD=''
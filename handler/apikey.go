@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"meow/lib/apikey"
+	"meow/lib/auth"
+	"meow/lib/httputil"
+	"meow/lib/policy"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	//the API key must expire, the client has to create a new one before then
+	API_KEY_MAX_LIFETIME = 365 * 24 * time.Hour
+)
+
+func init() {
+	//only the owner can see or revoke the key, the key is a secret of the user even to the admin
+	policy.Register(model.ApiKey{}.TableName(), policy.Rule{
+		OwnerColumn: "user_id",
+	})
+}
+
+//create an API key with a subset of the scopes of the user
+//the key is returned in this response only, it cannot be retrieved afterwards
+func ApiKeyCreate(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	var input struct {
+		Name   string   `json:"name" validate:"required,max=100"`
+		Scopes []string `json:"scopes" validate:"required,min=1"`
+		//in days
+		Lifetime int `json:"lifetime" validate:"required,min=1,max=365"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return http.StatusBadRequest, err, nil
+	}
+
+	user := model.User{}
+	if found, err := session.Id(userId).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	//the key cannot have more power than the user
+	delegable := auth.RemoveScopes(auth.UserScopes(user.Role, user.EmailVerified), auth.NON_DELEGABLE_SCOPES...)
+	for _, scope := range input.Scopes {
+		if len(auth.IntersectScopes([]string{scope}, delegable)) == 0 {
+			return http.StatusBadRequest, errors.New("The scope cannot be granted to the API key: " + scope), nil
+		}
+	}
+
+	key, err := apikey.New()
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	lifetime := time.Duration(input.Lifetime) * 24 * time.Hour
+	if lifetime > API_KEY_MAX_LIFETIME {
+		lifetime = API_KEY_MAX_LIFETIME
+	}
+	record := model.ApiKey{
+		Id:         uuid.NewV4().String(),
+		UserId:     userId,
+		Name:       input.Name,
+		KeyPrefix:  apikey.DisplayPrefix(key),
+		KeyDigest:  apikey.Digest(key),
+		Scopes:     apikey.JoinScopes(input.Scopes),
+		ExpireTime: time.Now().Add(lifetime),
+	}
+	if statusCode, err := createRecord(&record, session); err != nil {
+		return statusCode, err, nil
+	}
+	return http.StatusOK, nil, map[string]interface{}{"id": record.Id, "key": key, "keyPrefix": record.KeyPrefix, "expireTime": record.ExpireTime}
+}
+
+//list the API keys of the user, the expired keys are included thus the user can see which one to replace
+func ApiKeyList(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	keys := []model.ApiKey{}
+	condition, args, err := policy.Condition(model.ApiKey{}.TableName(), userId, policy.READ)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if err := db.Where(condition, args...).Desc("create_time").Find(&keys); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusOK, nil, keys
+}
+
+func ApiKeyDelete(urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	statusCode, err := deleteRecord(&model.ApiKey{}, urlValues["apiKeyId"], userId, session)
+	return statusCode, err, nil
+}
@@ -2,47 +2,342 @@ package handler
 
 import (
 	//"errors"
-	//	"log"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"meow/lib/auth"
+	"meow/lib/cookie"
 	"meow/lib/httputil"
 	"meow/lib/middleware"
+	"meow/lib/password"
+	"meow/lib/refresh"
+	"meow/lib/revocation"
+	"meow/lib/throttle"
+	"meow/lib/txhook"
 	"meow/model"
 
 	"github.com/go-xorm/xorm"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/satori/go.uuid"
 )
 
 func Login(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
 	//handle the input
 	var input struct {
-		Email    string `json:"email" validate:"required"`
-		Password string `json:"password" validate:"required"`
+		Email       string `json:"email" validate:"required"`
+		Password    string `json:"password" validate:"required"`
+		DeviceLabel string `json:"deviceLabel" validate:"max=100"`
 	}
 	if err := httputil.Bind(r.Body, &input); err != nil {
 		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 
+	//the attempt is counted before checking the password, thus a burst of requests cannot pass the limit together
+	//the request is rejected if the email or the client ip is locked out
+	throttleNames := []string{loginEmailThrottleName(input.Email), loginIpThrottleName(httputil.ClientIp(r))}
+	policies := []throttle.Policy{conf.LoginEmailThrottle, conf.LoginIpThrottle}
+	var lockoutOnFailure time.Duration
+	for i, name := range throttleNames {
+		if allowed, lockout, err := throttle.Attempt(name, policies[i]); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		} else if allowed == false {
+			sendTooManyRequests(w, lockout)
+			return
+		} else if lockout > lockoutOnFailure {
+			lockoutOnFailure = lockout
+		}
+	}
+
 	user := model.User{}
 	found, err := db.Where("email = ?", input.Email).Get(&user)
 	if err != nil {
 		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
-	if found == false || bcrypt.CompareHashAndPassword([]byte(user.PasswordDigest), []byte(input.Password)) != nil {
+	ok, rehash := false, false
+	if found {
+		if ok, rehash, err = password.Verify(input.Password, user.PasswordDigest); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if ok == false {
+		//this failure starts the lockout
+		if lockoutOnFailure > 0 {
+			sendTooManyRequests(w, lockoutOnFailure)
+			return
+		}
 		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "Incorrect Email / Password"})
 		return
 	}
 
-	if newToken, err := auth.Sign(user.Id); err != nil {
+	//the ip counter is not reset, otherwise an attacker owning one account can keep trying the other accounts
+	if err := throttle.Reset(throttleNames[0]); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := throttle.Forgive(throttleNames[1]); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	//upgrade the digest made by the outdated algorithm or parameters, the login goes on even if it fails
+	if rehash {
+		if err := rehashPassword(db, user, input.Password); err != nil {
+			log.Println("Failed to rehash the password of user", user.Id, err)
+		}
+	}
+
+	completeLogin(w, r, db, user, input.DeviceLabel)
+}
+
+//replace the password digest by the digest of the current hasher
+//the update is skipped if the password is changed concurrently
+func rehashPassword(db *xorm.Engine, user model.User, plainPassword string) error {
+	digest, err := password.Hash(plainPassword)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("update users set password_digest = ? where id = ? and password_digest = ?", digest, user.Id, user.PasswordDigest)
+	return err
+}
+
+//the user passed the first factor, e.g. the password
+//the user with TOTP enabled has to provide the code, before getting the access token
+func completeLogin(w http.ResponseWriter, r *http.Request, db *xorm.Engine, user model.User, deviceLabel string) {
+	if user.TotpEnabled {
+		if mfaToken, err := auth.SignMfaPending(user.Id, user.TokenVersion); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		} else {
+			middleware.Send(w, http.StatusOK, map[string]interface{}{"userId": user.Id, "mfaRequired": true, "mfaToken": mfaToken})
+		}
+		return
+	}
+
+	sendNewSession(w, r, db, user, deviceLabel)
+}
+
+//start a login session, and send the tokens of the session
+func sendNewSession(w http.ResponseWriter, r *http.Request, db *xorm.Engine, user model.User, deviceLabel string) {
+	session, refreshToken, err := startSession(r, db, user, deviceLabel)
+	if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	sendTokens(w, user, session.Id, refreshToken, cookie.IsRequested(r))
+}
+
+//clear the login failures and the lockout of the user, it is for admin only
+func LoginUnlock(urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	if _, err := uuid.FromString(urlValues["userId"]); err != nil {
+		return http.StatusBadRequest, errUuidNotValid, nil
+	}
+	user := model.User{}
+	if found, err := session.Id(urlValues["userId"]).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+
+	if err := throttle.Reset(loginEmailThrottleName(user.Email)); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func loginEmailThrottleName(email string) string {
+	return `login-email-` + strings.ToLower(email)
+}
+
+func loginIpThrottleName(ip string) string {
+	return `login-ip-` + ip
+}
+
+func sendTooManyRequests(w http.ResponseWriter, lockout time.Duration) {
+	//round up, thus the client doesn't retry before the lockout ends
+	seconds := int((lockout + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	middleware.Send(w, http.StatusTooManyRequests, map[string]string{"error": "Too many failed attempts, please retry later."})
+}
+
+//exchange the refresh token for a new access token and a new refresh token
+func Refresh(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	token, statusCode, err := readRefreshToken(r)
+	if err != nil {
+		middleware.Send(w, statusCode, map[string]string{"error": err.Error()})
+		return
+	}
+
+	userId, sessionId, tokenVersion, refreshToken, err := refresh.Rotate(token)
+	if err == refresh.ErrInvalidToken || err == refresh.ErrTokenReused {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	//the family of a revoked session is rejected, e.g. the session is logged out while its refresh token is being rotated
+	if valid, err := revocation.IsSessionValid(sessionId); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if valid == false {
+		if err := refresh.RevokeFamily(userId, sessionId); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": refresh.ErrInvalidToken.Error()})
+		return
+	}
+
+	//reload the user, thus the new access token carries the latest token version
+	user := model.User{}
+	if found, err := db.Id(userId).Get(&user); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if found == false {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The user is deleted."})
+		return
+	}
+
+	//the family survives "logout everywhere" if it is missed by refresh.RevokeAll, it is rejected by the token version here
+	if tokenVersion != refresh.UNKNOWN_TOKEN_VERSION && tokenVersion != user.TokenVersion {
+		if err := refresh.RevokeFamily(userId, sessionId); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": refresh.ErrInvalidToken.Error()})
+		return
+	}
+	sendTokens(w, user, sessionId, refreshToken, cookie.IsRequested(r))
+}
+
+//revoke the refresh token and end the session, the access tokens of the session are rejected too
+func Logout(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	token, statusCode, err := readRefreshToken(r)
+	if err != nil {
+		middleware.Send(w, statusCode, map[string]string{"error": err.Error()})
+		return
+	}
+
+	userId, sessionId, err := refresh.Revoke(token)
+	if err != nil {
 		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if sessionId != `` {
+		//not in a transaction, the revocation is committed immediately
+		session := db.NewSession()
+		defer session.Close()
+		defer txhook.Discard(session)
+		if _, err := revocation.RevokeSession(session, userId, sessionId); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if cookie.IsRequested(r) {
+		cookie.Clear(w)
+	}
+	middleware.Send(w, http.StatusNoContent, nil)
+}
+
+//the refresh token is in the request body, or in the cookie for the cookie mode
+//empty token is returned if the cookie is absent, it is rejected as an invalid token
+func readRefreshToken(r *http.Request) (token string, statusCode int, err error) {
+	if cookie.IsRequested(r) {
+		//the CSRF token is checked against the session of the refresh token before it is used
+		//the invalid token is returned as is, it is rejected by the caller anyway
+		token = cookie.Get(r, cookie.REFRESH_TOKEN)
+		sessionId, err := refresh.FamilyOf(token)
+		if err == refresh.ErrInvalidToken {
+			return token, http.StatusOK, nil
+		} else if err != nil {
+			return ``, http.StatusInternalServerError, err
+		}
+		if cookie.CheckCsrf(r, sessionId) == false {
+			return ``, http.StatusForbidden, cookie.ErrCsrfToken
+		}
+		return token, http.StatusOK, nil
+	}
+
+	var input struct {
+		RefreshToken string `json:"refreshToken" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return ``, http.StatusBadRequest, err
+	}
+	return input.RefreshToken, http.StatusOK, nil
+}
+
+//logout all sessions of the user, by revoking all refresh tokens and increasing the token version
+func LogoutAll(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	if err := revokeAllTokens(session, userId); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+//revoke all the access tokens and refresh tokens of the user
+//the refresh tokens are revoked after the commit, thus they are kept if the transaction is rolled back
+func revokeAllTokens(session *xorm.Session, userId string) error {
+	if err := revocation.IncreaseTokenVersion(session, userId); err != nil {
+		return err
+	}
+	if err := revocation.RevokeAllSessions(session, userId); err != nil {
+		return err
+	}
+	txhook.AfterCommit(session, func() error {
+		return refresh.RevokeAll(userId)
+	})
+	return nil
+}
+
+//sign a new access token of the session and send it to the client, together with the refresh token
+//in the cookie mode, the tokens are sent in the HttpOnly cookies, and the CSRF token is sent instead
+func sendTokens(w http.ResponseWriter, user model.User, sessionId string, refreshToken string, useCookie bool) {
+	claims := auth.Claims{
+		UserId:       user.Id,
+		SessionId:    sessionId,
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
+		Scopes:       auth.UserScopes(user.Role, user.EmailVerified),
+	}
+	if newToken, err := auth.Sign(claims); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	} else if useCookie {
+		csrfToken := cookie.CsrfToken(sessionId)
+		cookie.SetTokens(w, newToken, refreshToken, csrfToken)
+		middleware.Send(w, http.StatusOK, map[string]string{"userId": user.Id, "sessionId": sessionId, "csrfToken": csrfToken})
 	} else {
 		// update JWT Token
 		w.Header().Add("Authorization", newToken)
 		//allow CORS
 		w.Header().Set("Access-Control-Expose-Headers", "Authorization")
-		middleware.Send(w, http.StatusOK, map[string]string{"userId": user.Id})
+		middleware.Send(w, http.StatusOK, map[string]string{"userId": user.Id, "sessionId": sessionId, "refreshToken": refreshToken})
 	}
 }
+
+//reject a single access token by its id (the jti claim), e.g. the token is leaked. It is for admin only
+//the other tokens of the user are not affected
+func TokenDeny(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	if _, err := uuid.FromString(urlValues["tokenId"]); err != nil {
+		return http.StatusBadRequest, errUuidNotValid, nil
+	}
+	if err := revocation.DenyToken(urlValues["tokenId"], auth.MaxTokenAge()); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+//publish the public keys in JWKS format, thus other services can verify the tokens issued by us
+//the keys are read from the keyring in every request, thus the output follows the key rotation
+func Jwks(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	//a short cache period, so that the other services see the new key soon after the rotation
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	middleware.Send(w, http.StatusOK, map[string][]auth.JsonWebKey{"keys": auth.JsonWebKeys()})
+}
@@ -5,17 +5,29 @@ import (
 	"net/http"
 
 	"meow/lib/httputil"
+	"meow/lib/policy"
 	"meow/model"
 
 	"github.com/go-xorm/xorm"
 	"github.com/satori/go.uuid"
 )
 
-func CatGetOne(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
-	//FIXME: add object level privilege checking
+func init() {
+	//the owner can do everything, the users who are shared with can read only
+	policy.Register(model.Cat{}.TableName(), policy.Rule{
+		OwnerColumn:   "user_id",
+		ShareTable:    model.CatShare{}.TableName(),
+		ShareColumn:   "cat_id",
+		SharedActions: []policy.Action{policy.READ},
+		AdminOverride: true,
+		//e.g. the billing service reads the cat of any user
+		ServiceActions: []policy.Action{policy.READ},
+	})
+}
 
+func CatGetOne(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
 	cat := model.Cat{}
-	statusCode, err := getRecordDirect(&cat, urlValues["catId"], db)
+	statusCode, err := getRecordDirect(&cat, urlValues["catId"], userId, db)
 
 	return statusCode, err, cat
 }
@@ -26,7 +38,7 @@ func CatUpdate(r *http.Request, urlValues map[string]string, session *xorm.Sessi
 	if err != nil {
 		return http.StatusBadRequest, err, nil
 	}
-	statusCode, err := updateRecordWithUserId(&cat, dbUpdateFields, urlValues["catId"], userId, session)
+	statusCode, err := updateRecord(&cat, dbUpdateFields, urlValues["catId"], userId, session)
 	return statusCode, err, nil
 }
 
@@ -47,6 +59,47 @@ func CatCreate(r io.Reader, urlValues map[string]string, session *xorm.Session,
 }
 
 func CatDelete(urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
-	statusCode, err := deleteRecordWithUserId(&model.Cat{}, urlValues["catId"], userId, session)
+	statusCode, err := deleteRecord(&model.Cat{}, urlValues["catId"], userId, session)
 	return statusCode, err, nil
 }
+
+//share the cat with other user, only the user who can update the cat can share it
+func CatShareCreate(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	if statusCode, err := getRecord(&model.Cat{}, urlValues["catId"], userId, policy.UPDATE, session); err != nil {
+		return statusCode, err, nil
+	}
+	if statusCode, err := getUser(urlValues["userId"], session); err != nil {
+		return statusCode, err, nil
+	}
+
+	share := model.CatShare{CatId: urlValues["catId"], UserId: urlValues["userId"]}
+	if found, err := session.Where("cat_id = ? and user_id = ?", share.CatId, share.UserId).Get(&model.CatShare{}); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found {
+		//already shared
+		return http.StatusNoContent, nil, nil
+	}
+
+	if statusCode, err := createRecord(&share, session); err != nil {
+		return statusCode, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func CatShareDelete(urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	if statusCode, err := getRecord(&model.Cat{}, urlValues["catId"], userId, policy.UPDATE, session); err != nil {
+		return statusCode, err, nil
+	}
+	if _, err := uuid.FromString(urlValues["userId"]); err != nil {
+		return http.StatusBadRequest, errUuidNotValid, nil
+	}
+
+	affected, err := session.Where("cat_id = ? and user_id = ?", urlValues["catId"], urlValues["userId"]).Delete(&model.CatShare{})
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if affected == 0 {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
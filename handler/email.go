@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"meow/lib/httputil"
+	"meow/lib/mail"
+	"meow/lib/middleware"
+	"meow/lib/policy"
+	"meow/lib/txhook"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+)
+
+var errEmailTaken = errors.New("The email is already registered.")
+
+//the first step of changing the email, the confirmation token is sent to the new email, and the old email is notified
+//the email is not changed until the token is confirmed, thus a typo in the new email doesn't lock the user out
+func UserEmailChange(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	var input struct {
+		NewEmail        string `json:"newEmail" validate:"required,email,max=200"`
+		CurrentPassword string `json:"currentPassword"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return http.StatusBadRequest, err, nil
+	}
+
+	user := model.User{}
+	if statusCode, err := getRecord(&user, urlValues["userId"], userId, policy.UPDATE, session); err != nil {
+		return statusCode, err, nil
+	}
+	if _, statusCode, err := reauthenticate(session, middleware.ClaimsOf(r), user, input.CurrentPassword); err != nil {
+		return statusCode, err, nil
+	}
+
+	if input.NewEmail == user.Email {
+		return http.StatusBadRequest, errors.New("The new email is the same as the current email."), nil
+	}
+	//checked again on the confirmation by users_u1, as the email may be registered in between
+	if taken, err := session.Where("email = ?", input.NewEmail).Get(&model.User{}); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if taken {
+		return http.StatusConflict, errEmailTaken, nil
+	}
+
+	token, err := issueUserToken(session, model.UserToken{UserId: user.Id, Purpose: PURPOSE_EMAIL_CHANGE, NewEmail: input.NewEmail}, conf.EmailChangeTokenLifetime)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+
+	//the emails are sent after the commit, thus the token in the email is always valid
+	//the user can request again if the confirmation is not sent, the failures are logged by txhook
+	confirmBody := "Please visit the following link to confirm your new email:\n\n" +
+		conf.EmailChangeUrl + "?token=" + url.QueryEscape(token) + "\n\n" +
+		"The link will expire in " + conf.EmailChangeTokenLifetime.String() + ".\n"
+	notifyBody := "A change of the email of your account to " + input.NewEmail + " is requested. " +
+		"The email is changed once the request is confirmed from the new email.\n\n" +
+		"If you didn't request it, please change your password immediately.\n"
+	txhook.AfterCommit(session, func() error {
+		return mail.Send(input.NewEmail, "Confirm your new email", confirmBody)
+	})
+	txhook.AfterCommit(session, func() error {
+		return mail.Send(user.Email, "Your email is being changed", notifyBody)
+	})
+	return http.StatusNoContent, nil, nil
+}
+
+//the second step of changing the email, the token proves the user owns the new email
+//the pending password reset tokens are invalidated, as they were sent to the old email
+func UserEmailConfirm(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	var input struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	session := db.NewSession()
+	if err := session.Begin(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer session.Close()
+
+	userToken, statusCode, err := consumeUserToken(session, input.Token, PURPOSE_EMAIL_CHANGE)
+	if err != nil {
+		middleware.Send(w, statusCode, map[string]string{"error": err.Error()})
+		return
+	}
+
+	user := model.User{Email: userToken.NewEmail, EmailVerified: true}
+	if _, err := session.Id(userToken.UserId).Cols("email", "email_verified").Update(&user); isUniqueViolation(err, "users_u1") {
+		middleware.Send(w, http.StatusConflict, map[string]string{"error": errEmailTaken.Error()})
+		return
+	} else if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, err := session.Exec("update user_tokens set use_time = now() where user_id = ? and purpose = ? and use_time is null", userToken.UserId, PURPOSE_PASSWORD_RESET); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := session.Commit(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	middleware.Send(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"meow/lib/audit"
+	"meow/lib/export"
+	"meow/lib/middleware"
+	"meow/lib/policy"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+func init() {
+	//the user can access his own exports only
+	policy.Register(model.ExportJob{}.TableName(), policy.Rule{OwnerColumn: "user_id"})
+}
+
+//request the export of the personal data, the archive is built in background
+//the unfinished job is returned instead of queuing another one
+func ExportCreate(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	if statusCode, err := getRecordDirect(&model.User{}, urlValues["userId"], userId, db); err != nil {
+		return statusCode, err, nil
+	}
+
+	if job, found, err := findUnfinishedExport(userId, db); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found {
+		return http.StatusAccepted, nil, job
+	}
+
+	//not in a transaction, thus the worker can see the job once it is notified
+	job := model.ExportJob{
+		Id:     uuid.NewV4().String(),
+		UserId: userId,
+		Status: export.STATUS_PENDING,
+	}
+	if _, err := db.Exec("insert into export_jobs (id, user_id, status) values (?, ?, ?)", job.Id, job.UserId, job.Status); isUniqueViolation(err, "export_jobs_u1") {
+		//a concurrent request has just queued the job
+		if job, found, err := findUnfinishedExport(userId, db); err != nil {
+			return http.StatusInternalServerError, err, nil
+		} else if found {
+			return http.StatusAccepted, nil, job
+		}
+		return http.StatusConflict, errors.New("The export is just finished, please check the latest export."), nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	export.Notify()
+	return http.StatusAccepted, nil, job
+}
+
+//the pending or running job of the user, there is at most one by export_jobs_u1
+func findUnfinishedExport(userId string, db *xorm.Engine) (model.ExportJob, bool, error) {
+	job := model.ExportJob{}
+	found, err := db.Where("user_id = ? and status in (?, ?)", userId, export.STATUS_PENDING, export.STATUS_RUNNING).Get(&job)
+	return job, found, err
+}
+
+//the status of the export, the client polls it until the status is done
+func ExportGetOne(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	job := model.ExportJob{}
+	statusCode, err := getExportJob(&job, urlValues, userId, db)
+	return statusCode, err, job
+}
+
+//download the archive of the finished export
+func ExportDownload(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	job := model.ExportJob{}
+	if statusCode, err := getExportJob(&job, urlValues, userId, db); err != nil {
+		return statusCode, err, nil
+	}
+
+	switch job.Status {
+	case export.STATUS_DONE:
+	case export.STATUS_EXPIRED:
+		return http.StatusGone, errors.New("The archive is expired, please request the export again."), nil
+	case export.STATUS_FAILED:
+		return http.StatusConflict, errors.New("The export is failed, please request the export again."), nil
+	default:
+		return http.StatusConflict, errors.New("The archive is not ready yet."), nil
+	}
+	return http.StatusOK, nil, middleware.File{
+		Path:        export.ArchivePath(job.UserId, job.Id),
+		Name:        "meow-export-" + job.FinishTime.Format("20060102") + ".zip",
+		ContentType: "application/zip",
+	}
+}
+
+func getExportJob(job *model.ExportJob, urlValues map[string]string, userId string, db *xorm.Engine) (int, error) {
+	if statusCode, err := getRecordDirect(job, urlValues["exportId"], userId, db); err != nil {
+		return statusCode, err
+	}
+	if job.UserId != urlValues["userId"] {
+		return http.StatusNotFound, errNotFound
+	}
+	return http.StatusOK, nil
+}
+
+//the builder of the export archive for the worker
+//the user record leaves out the credentials, e.g. the password digest, by the json tags of the model
+func ExportBuilder(db *xorm.Engine) export.Builder {
+	return func(userId string, archive *zip.Writer) error {
+		user := model.User{}
+		if found, err := db.Id(userId).Get(&user); err != nil {
+			return err
+		} else if found == false {
+			return errors.New("The user is not found.")
+		}
+		if err := writeJson(archive, "user.json", user); err != nil {
+			return err
+		}
+
+		cats := []model.Cat{}
+		if err := db.Where("user_id = ?", userId).Find(&cats); err != nil {
+			return err
+		}
+		if err := writeJson(archive, "cats.json", cats); err != nil {
+			return err
+		}
+
+		history, err := audit.UserHistory(userId)
+		if err != nil {
+			return err
+		}
+		return writeJson(archive, "audit.json", json.RawMessage(history))
+	}
+}
+
+func writeJson(archive *zip.Writer, name string, data interface{}) error {
+	b, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
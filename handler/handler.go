@@ -3,8 +3,13 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"time"
+
+	"meow/lib/policy"
+	"meow/lib/throttle"
 
 	"github.com/go-xorm/xorm"
+	"github.com/lib/pq"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -13,30 +18,70 @@ var (
 	errUuidNotValid = errors.New("The provided uuid is invalid.")
 )
 
-//the id should be a uuid
-func getRecord(out interface{}, id string, session *xorm.Session) (statusCode int, err error) {
-	if _, err := uuid.FromString(id); err != nil {
-		return http.StatusBadRequest, errUuidNotValid
-	}
+//the settings of the handlers
+type Config struct {
+	//the brute-force protection of the login, counted per email and per client ip
+	LoginEmailThrottle throttle.Policy
+	LoginIpThrottle    throttle.Policy
 
-	found, err := session.Id(id).Get(out)
+	//the web page for resetting the password, the token is appended as the query parameter "token"
+	PasswordResetUrl           string
+	PasswordResetTokenLifetime time.Duration
+	//the password reset requests allowed, counted per email and per client ip
+	PasswordResetEmailThrottle throttle.Policy
+	PasswordResetIpThrottle    throttle.Policy
 
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	if found == false {
-		return http.StatusNotFound, errNotFound
-	}
+	//the web page for verifying the email, the token is appended as the query parameter "token"
+	EmailVerifyUrl           string
+	EmailVerifyTokenLifetime time.Duration
 
-	return http.StatusOK, nil
+	//the web page for confirming the new email, the token is appended as the query parameter "token"
+	EmailChangeUrl           string
+	EmailChangeTokenLifetime time.Duration
+
+	//the web page of the frontend, where the OpenID Connect callback redirects the browser to
+	OidcFrontendUrl string
+
+	//the issuer shown in the authenticator app
+	TotpIssuer string
+
+	//the lifetime of the token for the admin to impersonate the user
+	ImpersonationTokenLifetime time.Duration
+
+	//the password can be changed without the current password within this period after the login of the session
+	SudoWindow time.Duration
+}
+
+var conf Config
+
+func Init(c Config) {
+	conf = c
 }
 
-func getRecordDirect(out interface{}, id string, db *xorm.Engine) (statusCode int, err error) {
+//check if the error is raised by the unique constraint, e.g. users_u1 on the email
+func isUniqueViolation(err error, constraint string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+//all the models implement this interface, the table name is used for looking up the policy
+type tableNamer interface {
+	TableName() string
+}
+
+//the id should be a uuid
+//only the record which the user can perform the action on will be found
+func getRecord(out tableNamer, id, userId string, action policy.Action, session *xorm.Session) (statusCode int, err error) {
 	if _, err := uuid.FromString(id); err != nil {
 		return http.StatusBadRequest, errUuidNotValid
 	}
 
-	found, err := db.Id(id).Get(out)
+	condition, args, err := policy.Condition(out.TableName(), userId, action)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	found, err := session.Where("id = ?", id).And(condition, args...).Get(out)
+
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -47,12 +92,16 @@ func getRecordDirect(out interface{}, id string, db *xorm.Engine) (statusCode in
 	return http.StatusOK, nil
 }
 
-func getRecordWithUserIdDirect(out interface{}, id, userId string, db *xorm.Engine) (statusCode int, err error) {
+func getRecordDirect(out tableNamer, id, userId string, db *xorm.Engine) (statusCode int, err error) {
 	if _, err := uuid.FromString(id); err != nil {
 		return http.StatusBadRequest, errUuidNotValid
 	}
 
-	found, err := db.Where("id = ? and user_id = ?", id, userId).Get(out)
+	condition, args, err := policy.Condition(out.TableName(), userId, policy.READ)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	found, err := db.Where("id = ?", id).And(condition, args...).Get(out)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -63,14 +112,19 @@ func getRecordWithUserIdDirect(out interface{}, id, userId string, db *xorm.Engi
 	return http.StatusOK, nil
 }
 
-func deleteRecordWithUserId(input interface{}, id, userId string, session *xorm.Session) (statusCode int, err error) {
+func deleteRecord(input tableNamer, id, userId string, session *xorm.Session) (statusCode int, err error) {
 	if _, err := uuid.FromString(id); err != nil {
 		return http.StatusBadRequest, errUuidNotValid
 	}
 	if _, err := uuid.FromString(userId); err != nil {
 		return http.StatusBadRequest, errUuidNotValid
 	}
-	affectedCount, err := session.Where("id = ? and user_id = ?", id, userId).Delete(input)
+
+	condition, args, err := policy.Condition(input.TableName(), userId, policy.DELETE)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	affectedCount, err := session.Where("id = ?", id).And(condition, args...).Delete(input)
 
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -82,7 +136,7 @@ func deleteRecordWithUserId(input interface{}, id, userId string, session *xorm.
 	return http.StatusNoContent, err
 }
 
-func updateRecordWithUserId(input interface{}, fieldNames map[string]bool, id, userId string, session *xorm.Session) (statusCode int, err error) {
+func updateRecord(input tableNamer, fieldNames map[string]bool, id, userId string, session *xorm.Session) (statusCode int, err error) {
 	if _, err := uuid.FromString(id); err != nil {
 		return http.StatusBadRequest, errUuidNotValid
 	}
@@ -97,7 +151,11 @@ func updateRecordWithUserId(input interface{}, fieldNames map[string]bool, id, u
 	}
 
 	//update the database
-	affected, err := session.Where("id = ? and user_id = ?", id, userId).Cols(array...).Update(input)
+	condition, args, err := policy.Condition(input.TableName(), userId, policy.UPDATE)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	affected, err := session.Where("id = ?", id).And(condition, args...).Cols(array...).Update(input)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"meow/lib/audit"
+	"meow/lib/auth"
+	"meow/lib/httputil"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+//issue a short-lived token for the admin to act as the user, e.g. for reproducing the problem reported by the user. It is for admin only
+//the token carries the admin as the actor, every request made with it is recorded in audit.impersonations
+//it has no non-delegable scope, thus it cannot change the password, the email, or the other settings of the account
+func UserImpersonate(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	if _, err := uuid.FromString(urlValues["userId"]); err != nil {
+		return http.StatusBadRequest, errUuidNotValid, nil
+	}
+	if urlValues["userId"] == userId {
+		return http.StatusBadRequest, errors.New("The user cannot impersonate himself."), nil
+	}
+	user := model.User{}
+	if found, err := db.Id(urlValues["userId"]).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	//otherwise an admin can act as another admin without leaving his own trace in the audit of the admin functions
+	if user.Role == auth.ROLE_ADMIN {
+		return http.StatusForbidden, errors.New("The admin cannot be impersonated."), nil
+	}
+
+	claims := auth.Claims{
+		UserId:       user.Id,
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
+		Scopes:       auth.RemoveScopes(auth.UserScopes(user.Role, user.EmailVerified), auth.NON_DELEGABLE_SCOPES...),
+		ActorId:      userId,
+	}
+	token, err := auth.SignImpersonation(claims, conf.ImpersonationTokenLifetime)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if err := audit.Impersonation(userId, user.Id, r.Method, r.URL.Path, httputil.ClientIp(r)); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusOK, nil, map[string]interface{}{
+		"userId":     user.Id,
+		"token":      token,
+		"expireTime": time.Now().Add(conf.ImpersonationTokenLifetime),
+	}
+}
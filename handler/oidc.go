@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"meow/lib/auth"
+	"meow/lib/cookie"
+	"meow/lib/httputil"
+	"meow/lib/middleware"
+	"meow/lib/oidc"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+//redirect the browser to the identity provider
+func OidcLogin(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	if oidc.Enabled() == false {
+		middleware.Send(w, http.StatusNotFound, map[string]string{"error": "The OpenID Connect login is disabled."})
+		return
+	}
+
+	redirectUrl, state, err := oidc.AuthCodeUrl()
+	if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	cookie.SetOidc(w, cookie.OIDC_STATE, state, oidc.STATE_LIFETIME)
+	http.Redirect(w, r, redirectUrl, http.StatusFound)
+}
+
+//the identity provider redirects the browser back with the authorization code
+//the user is created on the first login. The browser is redirected to the frontend with the handover cookie,
+//and the frontend gets the tokens by OidcToken
+func OidcCallback(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	if oidc.Enabled() == false {
+		middleware.Send(w, http.StatusNotFound, map[string]string{"error": "The OpenID Connect login is disabled."})
+		return
+	}
+
+	//the state must be the one of this browser, otherwise an attacker can log the victim into the account of the attacker
+	query := r.URL.Query()
+	state := cookie.Get(r, cookie.OIDC_STATE)
+	cookie.SetOidc(w, cookie.OIDC_STATE, ``, 0)
+	if e := query.Get("error"); e != `` {
+		redirectOidcError(w, r, errors.New("The identity provider rejected the login: "+e))
+		return
+	}
+	if state == `` || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		redirectOidcError(w, r, oidc.ErrInvalidState)
+		return
+	}
+	identity, err := oidc.Exchange(state, query.Get("code"))
+	if err != nil {
+		redirectOidcError(w, r, err)
+		return
+	}
+
+	session := db.NewSession()
+	if err := session.Begin(); err != nil {
+		redirectOidcError(w, r, err)
+		return
+	}
+	defer session.Close()
+
+	user, _, err := findOrCreateOidcUser(session, identity)
+	if err != nil {
+		redirectOidcError(w, r, err)
+		return
+	}
+	if err := session.Commit(); err != nil {
+		redirectOidcError(w, r, err)
+		return
+	}
+
+	code, err := oidc.NewHandover(user.Id)
+	if err != nil {
+		redirectOidcError(w, r, err)
+		return
+	}
+	cookie.SetOidc(w, cookie.OIDC_HANDOVER, code, oidc.HANDOVER_LIFETIME)
+	http.Redirect(w, r, conf.OidcFrontendUrl, http.StatusFound)
+}
+
+//the frontend shows the error given by the query parameter "error"
+func redirectOidcError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("The OpenID Connect login failed:", err)
+	http.Redirect(w, r, conf.OidcFrontendUrl+"?error="+url.QueryEscape(err.Error()), http.StatusFound)
+}
+
+//the frontend exchanges the handover cookie set by the callback for the tokens, in the same way as the password login
+//thus the cookie mode and the second factor work the same
+func OidcToken(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	var input struct {
+		DeviceLabel string `json:"deviceLabel" validate:"max=100"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	code := cookie.Get(r, cookie.OIDC_HANDOVER)
+	cookie.SetOidc(w, cookie.OIDC_HANDOVER, ``, 0)
+	userId, err := oidc.RedeemHandover(code)
+	if err == oidc.ErrInvalidHandover {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	user := model.User{}
+	if found, err := db.Id(userId).Get(&user); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if found == false {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The user is deleted."})
+		return
+	}
+	completeLogin(w, r, db, user, input.DeviceLabel)
+}
+
+//find the user linked with the identity
+//for the first login, the identity is linked to the user with the same verified email, or a new user is created
+func findOrCreateOidcUser(session *xorm.Session, identity *oidc.Identity) (*model.User, int, error) {
+	user := model.User{}
+
+	userIdentity := model.UserIdentity{}
+	if found, err := session.Where("issuer = ? and subject = ?", identity.Issuer, identity.Subject).Get(&userIdentity); err != nil {
+		return nil, http.StatusInternalServerError, err
+	} else if found {
+		if found, err := session.Id(userIdentity.UserId).Get(&user); err != nil {
+			return nil, http.StatusInternalServerError, err
+		} else if found == false {
+			return nil, http.StatusUnauthorized, errors.New("The user is deleted.")
+		}
+		return &user, http.StatusOK, nil
+	}
+
+	if identity.Email == `` {
+		return nil, http.StatusBadRequest, errors.New("The identity provider doesn't provide the email.")
+	}
+
+	//the unverified email may belong to other people, thus it is not linked to the existing user
+	found := false
+	if identity.EmailVerified {
+		var err error
+		if found, err = session.Where("email = ?", identity.Email).Get(&user); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+	if found == false {
+		user = model.User{
+			Id:            uuid.NewV4().String(),
+			Email:         identity.Email,
+			EmailVerified: identity.EmailVerified,
+			Role:          auth.ROLE_USER,
+			FirstName:     identity.GivenName,
+			LastName:      identity.FamilyName,
+			//no password, thus the user cannot login by password until he resets it
+			PasswordDigest: ``,
+		}
+		if statusCode, err := createRecord(&user, session); err != nil {
+			return nil, statusCode, err
+		}
+	}
+
+	userIdentity = model.UserIdentity{
+		Id:      uuid.NewV4().String(),
+		UserId:  user.Id,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	}
+	if statusCode, err := createRecord(&userIdentity, session); err != nil {
+		return nil, statusCode, err
+	}
+	return &user, http.StatusOK, nil
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"meow/lib/audit"
+	"meow/lib/auth"
+	"meow/lib/httputil"
+	"meow/lib/mail"
+	"meow/lib/middleware"
+	"meow/lib/password"
+	"meow/lib/policy"
+	"meow/lib/refresh"
+	"meow/lib/revocation"
+	"meow/lib/throttle"
+	"meow/lib/txhook"
+	"meow/lib/validate"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+)
+
+//send the password reset token to the email of the user
+//it always returns 204 without waiting for the email, thus it cannot be used for checking if an email is registered
+func PasswordResetRequest(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	var input struct {
+		Email string `json:"email" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	//every request is counted, no matter the email is registered or not, as each of them may send an email
+	throttleNames := []string{`password-reset-email-` + strings.ToLower(input.Email), `password-reset-ip-` + httputil.ClientIp(r)}
+	policies := []throttle.Policy{conf.PasswordResetEmailThrottle, conf.PasswordResetIpThrottle}
+	for i, name := range throttleNames {
+		if allowed, lockout, err := throttle.Attempt(name, policies[i]); err != nil {
+			middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		} else if allowed == false {
+			sendTooManyRequests(w, lockout)
+			return
+		}
+	}
+
+	user := model.User{}
+	if found, err := db.Where("email = ?", input.Email).Get(&user); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if found {
+		go sendPasswordReset(db, user)
+	}
+	middleware.Send(w, http.StatusNoContent, nil)
+}
+
+//the failures are logged only, the user can request again
+func sendPasswordReset(db *xorm.Engine, user model.User) {
+	session := db.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		log.Println("Failed to create the password reset token", err)
+		return
+	}
+	token, err := createUserToken(session, user.Id, PURPOSE_PASSWORD_RESET, conf.PasswordResetTokenLifetime)
+	if err != nil {
+		log.Println("Failed to create the password reset token", err)
+		return
+	}
+	if err := session.Commit(); err != nil {
+		log.Println("Failed to create the password reset token", err)
+		return
+	}
+
+	body := "Please visit the following link to reset your password:\n\n" +
+		conf.PasswordResetUrl + "?token=" + url.QueryEscape(token) + "\n\n" +
+		"The link will expire in " + conf.PasswordResetTokenLifetime.String() + ". " +
+		"If you didn't request a password reset, please ignore this email.\n"
+	if err := mail.Send(user.Email, "Reset your password", body); err != nil {
+		log.Println("Failed to send the password reset email", err)
+	}
+}
+
+//set the new password with the password reset token, all the existing sessions of the user are logged out
+func PasswordResetConfirm(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	var input struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	session := db.NewSession()
+	if err := session.Begin(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer session.Close()
+	defer txhook.Discard(session)
+
+	userToken, statusCode, err := consumeUserToken(session, input.Token, PURPOSE_PASSWORD_RESET)
+	if err != nil {
+		middleware.Send(w, statusCode, map[string]string{"error": err.Error()})
+		return
+	}
+
+	//the token is not consumed if the password is rejected, as the transaction is rolled back
+	user := model.User{}
+	if found, err := session.Id(userToken.UserId).Get(&user); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if found == false {
+		middleware.Send(w, http.StatusNotFound, map[string]string{"error": errNotFound.Error()})
+		return
+	}
+	if statusCode, err := checkPasswordPolicy("password", input.Password, user); err != nil {
+		middleware.SendError(w, statusCode, err)
+		return
+	}
+
+	digest, err := password.Hash(input.Password)
+	if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, err := session.Id(userToken.UserId).Cols("password_digest").Update(&model.User{PasswordDigest: digest}); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := revokeAllTokens(session, userToken.UserId); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := audit.PasswordChange(session, userToken.UserId, ``, audit.VERIFIED_BY_RESET_TOKEN, httputil.ClientIp(r)); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := session.Commit(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	txhook.Committed(session)
+	middleware.Send(w, http.StatusNoContent, nil)
+}
+
+//change the password of the user himself. The current password is required, unless the session logged in within the sudo window
+//the other sessions are logged out, while the session making the change stays
+func UserPasswordUpdate(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return http.StatusBadRequest, err, nil
+	}
+
+	user := model.User{}
+	if statusCode, err := getRecord(&user, urlValues["userId"], userId, policy.UPDATE, session); err != nil {
+		return statusCode, err, nil
+	}
+
+	claims := middleware.ClaimsOf(r)
+	verifiedBy, statusCode, err := reauthenticate(session, claims, user, input.CurrentPassword)
+	if err != nil {
+		return statusCode, err, nil
+	}
+
+	if statusCode, err := checkPasswordPolicy("newPassword", input.NewPassword, user); err != nil {
+		return statusCode, err, nil
+	}
+	digest, err := password.Hash(input.NewPassword)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if _, err := session.Id(user.Id).Cols("password_digest").Update(&model.User{PasswordDigest: digest}); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+
+	revoked, err := revocation.RevokeOtherSessions(session, user.Id, claims.SessionId)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	for _, sessionId := range revoked {
+		if err := refresh.RevokeFamily(user.Id, sessionId); err != nil {
+			return http.StatusInternalServerError, err, nil
+		}
+	}
+
+	if err := audit.PasswordChange(session, user.Id, claims.SessionId, verifiedBy, httputil.ClientIp(r)); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+//the user proves the identity again before changing the credentials, by the current password or a recent login
+//the way of the proof is returned for the audit record
+func reauthenticate(session *xorm.Session, claims auth.Claims, user model.User, currentPassword string) (verifiedBy string, statusCode int, err error) {
+	if currentPassword != `` {
+		if statusCode, err := checkCurrentPassword(user, currentPassword); err != nil {
+			return ``, statusCode, err
+		}
+		return audit.VERIFIED_BY_PASSWORD, http.StatusOK, nil
+	}
+
+	if recent, err := isRecentLogin(session, claims); err != nil {
+		return ``, http.StatusInternalServerError, err
+	} else if recent == false {
+		return ``, http.StatusForbidden, errors.New("The current password is required, or please login again.")
+	}
+	return audit.VERIFIED_BY_RECENT_AUTH, http.StatusOK, nil
+}
+
+//the wrong current passwords are counted as the login failures of the email, thus a stolen token cannot be used for guessing the password
+func checkCurrentPassword(user model.User, plainPassword string) (int, error) {
+	//counted before the password is checked, thus the concurrent guesses cannot pass the limit together
+	throttleName := loginEmailThrottleName(user.Email)
+	if allowed, _, err := throttle.Attempt(throttleName, conf.LoginEmailThrottle); err != nil {
+		return http.StatusInternalServerError, err
+	} else if allowed == false {
+		return http.StatusTooManyRequests, errors.New("Too many failed attempts, please retry later.")
+	}
+
+	ok, _, err := password.Verify(plainPassword, user.PasswordDigest)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if ok == false {
+		return http.StatusForbidden, errors.New("The current password is incorrect.")
+	}
+	if err := throttle.Reset(throttleName); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+//the session is created on the login, thus its create time is the time the user proved the identity
+//the AuthTime in the token cannot be used, as it is reset whenever the token is refreshed
+func isRecentLogin(session *xorm.Session, claims auth.Claims) (bool, error) {
+	if claims.SessionId == `` || conf.SudoWindow <= 0 {
+		return false, nil
+	}
+	userSession := model.UserSession{}
+	found, err := session.Where("id = ? and user_id = ? and revoke_time is null", claims.SessionId, claims.UserId).Get(&userSession)
+	if err != nil {
+		return false, err
+	}
+	return found && time.Since(userSession.CreateTime) <= conf.SudoWindow, nil
+}
+
+//check the new password against the password policy, the names and the email of the user should not be part of it
+//the rejection is returned as the field level validation errors of fieldName, the json name of the password in the input,
+//thus the client can show the reasons next to the field
+func checkPasswordPolicy(fieldName string, plainPassword string, user model.User) (int, error) {
+	problems, err := password.Check(plainPassword, user.Email, user.FirstName, user.LastName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if len(problems) > 0 {
+		return http.StatusBadRequest, validate.FieldErrors{fieldName: problems}
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"meow/lib/httputil"
+	"meow/lib/refresh"
+	"meow/lib/revocation"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	//the user agent is truncated to fit in the database
+	MAX_USER_AGENT_LENGTH = 500
+)
+
+//record the login session of the device, and return the session with its first refresh token
+func startSession(r *http.Request, db *xorm.Engine, user model.User, deviceLabel string) (*model.UserSession, string, error) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > MAX_USER_AGENT_LENGTH {
+		userAgent = userAgent[:MAX_USER_AGENT_LENGTH]
+	}
+	session := model.UserSession{
+		Id:           uuid.NewV4().String(),
+		UserId:       user.Id,
+		DeviceLabel:  deviceLabel,
+		UserAgent:    userAgent,
+		IpAddress:    httputil.ClientIp(r),
+		LastSeenTime: time.Now(),
+	}
+	if _, err := db.Insert(&session); err != nil {
+		return nil, ``, err
+	}
+
+	refreshToken, err := refresh.Issue(user.Id, session.Id, user.TokenVersion)
+	if err != nil {
+		return nil, ``, err
+	}
+	return &session, refreshToken, nil
+}
+
+//list the active login sessions of the user, the most recent one first
+//the client can find its own session by the sessionId returned on login
+func SessionList(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
+	sessions := []model.UserSession{}
+	if err := db.Where("user_id = ? and revoke_time is null", userId).Desc("last_seen_time").Find(&sessions); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusOK, nil, sessions
+}
+
+//logout the session on a device, both of its access tokens and refresh tokens are revoked
+func SessionDelete(urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	sessionId := urlValues["sessionId"]
+	if _, err := uuid.FromString(sessionId); err != nil {
+		return http.StatusBadRequest, errUuidNotValid, nil
+	}
+
+	if found, err := revocation.RevokeSession(session, userId, sessionId); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	if err := refresh.RevokeFamily(userId, sessionId); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"meow/lib/randtoken"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+//the purposes of the user tokens
+const (
+	PURPOSE_PASSWORD_RESET = `PASSWORD_RESET`
+	PURPOSE_EMAIL_VERIFY   = `EMAIL_VERIFY`
+	PURPOSE_EMAIL_CHANGE   = `EMAIL_CHANGE`
+)
+
+var errTokenNotValid = errors.New("The token is invalid or expired.")
+
+//create a single-use token for the user, the unused tokens of the same purpose are invalidated
+func createUserToken(session *xorm.Session, userId, purpose string, lifetime time.Duration) (token string, err error) {
+	return issueUserToken(session, model.UserToken{UserId: userId, Purpose: purpose}, lifetime)
+}
+
+//the UserId and Purpose of the userToken should be set, the other fields are filled here
+func issueUserToken(session *xorm.Session, userToken model.UserToken, lifetime time.Duration) (token string, err error) {
+	if _, err := session.Exec("update user_tokens set use_time = now() where user_id = ? and purpose = ? and use_time is null", userToken.UserId, userToken.Purpose); err != nil {
+		return ``, err
+	}
+
+	if token, err = randtoken.New(); err != nil {
+		return ``, err
+	}
+	userToken.Id = uuid.NewV4().String()
+	userToken.TokenDigest = randtoken.Digest(token)
+	userToken.ExpireTime = time.Now().Add(lifetime)
+	if _, err := createRecord(&userToken, session); err != nil {
+		return ``, err
+	}
+	return token, nil
+}
+
+//mark the token as used, and return the token record
+func consumeUserToken(session *xorm.Session, token, purpose string) (userToken *model.UserToken, statusCode int, err error) {
+	t := model.UserToken{}
+	found, err := session.Where("token_digest = ? and purpose = ? and use_time is null and expire_time > now()", randtoken.Digest(token), purpose).Get(&t)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if found == false {
+		return nil, http.StatusBadRequest, errTokenNotValid
+	}
+
+	//the condition on use_time ensures the token is used once only, even for concurrent requests
+	result, err := session.Exec("update user_tokens set use_time = now() where id = ? and use_time is null", t.Id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	} else if affected == 0 {
+		return nil, http.StatusBadRequest, errTokenNotValid
+	}
+	return &t, http.StatusOK, nil
+}
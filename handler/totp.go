@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"meow/lib/auth"
+	"meow/lib/httputil"
+	"meow/lib/middleware"
+	"meow/lib/revocation"
+	"meow/lib/throttle"
+	"meow/lib/totp"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	RECOVERY_CODE_COUNT = 10
+
+	//the alphabet excludes the similar characters, e.g. 0 and o
+	recoveryCodeAlphabet = `abcdefghjkmnpqrstuvwxyz23456789`
+	recoveryCodeLength   = 10
+)
+
+var errTotpEnabled = errors.New("The TOTP is already enabled.")
+
+//start the TOTP enrollment, the TOTP is enabled once the first code is confirmed
+func TotpEnroll(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	user := model.User{}
+	if found, err := session.Id(userId).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	if user.TotpEnabled {
+		return http.StatusConflict, errTotpEnabled, nil
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if _, err := session.Id(userId).Cols("totp_secret").Update(&model.User{TotpSecret: secret}); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusOK, nil, map[string]string{"secret": secret, "uri": totp.Uri(conf.TotpIssuer, user.Email, secret)}
+}
+
+//enable the TOTP with the first code from the authenticator app, the recovery codes are returned and never shown again
+func TotpConfirm(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	var input struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return http.StatusBadRequest, err, nil
+	}
+
+	user := model.User{}
+	if found, err := session.Id(userId).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	if user.TotpEnabled {
+		return http.StatusConflict, errTotpEnabled, nil
+	}
+	if user.TotpSecret == `` {
+		return http.StatusBadRequest, errors.New("Please start the TOTP enrollment first."), nil
+	}
+
+	if ok, err := totp.Verify(user.Id, user.TotpSecret, input.Code); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if ok == false {
+		return http.StatusBadRequest, errors.New("The code is incorrect."), nil
+	}
+
+	if _, err := session.Id(userId).Cols("totp_enabled").Update(&model.User{TotpEnabled: true}); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	codes, err := createRecoveryCodes(session, userId)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusOK, nil, map[string][]string{"recoveryCodes": codes}
+}
+
+//disable the TOTP, either a code or a recovery code is required
+func TotpDisable(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return http.StatusBadRequest, err, nil
+	}
+
+	user := model.User{}
+	if found, err := session.Id(userId).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	if user.TotpEnabled == false {
+		return http.StatusNoContent, nil, nil
+	}
+
+	if ok, err := checkSecondFactor(session, user, input.Code, input.RecoveryCode); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if ok == false {
+		return http.StatusBadRequest, errors.New("The code is incorrect."), nil
+	}
+
+	if _, err := session.Exec("update users set totp_enabled = false, totp_secret = '' where id = ?", userId); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if _, err := session.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}); err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+//the second step of the login, exchange the mfa token for the access token with a code or a recovery code
+func LoginMfa(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	var input struct {
+		MfaToken     string `json:"mfaToken" validate:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+		DeviceLabel  string `json:"deviceLabel" validate:"max=100"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	pending, err := auth.VerifyMfaPending(input.MfaToken)
+	if err != nil {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+	userId := pending.UserId
+
+	//the code has 6 digits only, thus the attempts are throttled per user
+	//the attempt is counted before checking the code, thus a burst of requests cannot pass the limit together
+	throttleName := `mfa-` + userId
+	allowed, lockoutOnFailure, err := throttle.Attempt(throttleName, conf.LoginEmailThrottle)
+	if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if allowed == false {
+		sendTooManyRequests(w, lockoutOnFailure)
+		return
+	}
+
+	session := db.NewSession()
+	if err := session.Begin(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer session.Close()
+
+	user := model.User{}
+	if found, err := session.Id(userId).Get(&user); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if found == false {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The user is deleted."})
+		return
+	}
+	//the pending token is revoked with the other tokens, e.g. by a password reset or "log out everywhere"
+	if user.TokenVersion != pending.TokenVersion {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The MFA token is revoked, please login again."})
+		return
+	}
+	//the TOTP may be disabled after the password is verified
+	if user.TotpEnabled == false {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The second factor is not enabled, please login again."})
+		return
+	}
+
+	if ok, err := checkSecondFactor(session, user, input.Code, input.RecoveryCode); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if ok == false {
+		if lockoutOnFailure > 0 {
+			sendTooManyRequests(w, lockoutOnFailure)
+			return
+		}
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The code is incorrect."})
+		return
+	}
+
+	//the token is exchanged once only, otherwise it gives another session with the same code within its time window
+	if first, err := revocation.UseToken(pending.TokenId, auth.MaxMfaTokenAge()); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	} else if first == false {
+		middleware.Send(w, http.StatusUnauthorized, map[string]string{"error": "The MFA token is already used, please login again."})
+		return
+	}
+
+	if err := session.Commit(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := throttle.Reset(throttleName); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	sendNewSession(w, r, db, user, input.DeviceLabel)
+}
+
+//check either the TOTP code or the recovery code. The recovery code is deleted once it is used
+func checkSecondFactor(session *xorm.Session, user model.User, code, recoveryCode string) (bool, error) {
+	if code != `` {
+		return totp.Verify(user.Id, user.TotpSecret, code)
+	}
+	if recoveryCode != `` {
+		affected, err := session.Where("user_id = ? and code_digest = ?", user.Id, recoveryCodeDigest(user.Id, recoveryCode)).Delete(&model.RecoveryCode{})
+		return affected == 1, err
+	}
+	return false, nil
+}
+
+//replace the recovery codes of the user by the new codes
+func createRecoveryCodes(session *xorm.Session, userId string) ([]string, error) {
+	if _, err := session.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}); err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = recoveryCodeAlphabet[int(b[j])%len(recoveryCodeAlphabet)]
+		}
+		code := string(b[:recoveryCodeLength/2]) + `-` + string(b[recoveryCodeLength/2:])
+
+		recoveryCode := model.RecoveryCode{
+			Id:         uuid.NewV4().String(),
+			UserId:     userId,
+			CodeDigest: recoveryCodeDigest(userId, code),
+		}
+		if _, err := createRecord(&recoveryCode, session); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+//the userId acts as the salt. The separator and the case are ignored, as the user may type the code manually
+func recoveryCodeDigest(userId, code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(userId + `:` + normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,53 +1,111 @@
 package handler
 
 import (
-	//	"log"
+	"errors"
+	"log"
 	"net/http"
 
 	"meow/lib/auth"
+	"meow/lib/export"
 	"meow/lib/httputil"
 	"meow/lib/middleware"
+	"meow/lib/password"
+	"meow/lib/policy"
+	"meow/lib/refresh"
+	"meow/lib/revocation"
+	"meow/lib/txhook"
 	"meow/model"
 
 	"github.com/go-xorm/xorm"
 	"github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func UserGetOne(res http.ResponseWriter, req *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (error, int, interface{}) {
-	//FIXME: add object level privilege checking
+func init() {
+	//the user can access his own record only
+	policy.Register(model.User{}.TableName(), policy.Rule{OwnerColumn: "id"})
+}
 
+func UserGetOne(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (int, error, interface{}) {
 	user := model.User{}
-	statusCode, err := getRecord(&user, urlValues["userId"], session)
+	statusCode, err := getRecordDirect(&user, urlValues["userId"], userId, db)
 
-	return err, statusCode, user
+	return statusCode, err, user
 }
 
-/*
-func UserUpdate(w http.ResponseWriter, r *http.Request, urlValues map[string]string, authInput *auth.AuthInput) {
-	//TODO: not handled subuser concept
-	if authInput.User.Id != urlValues["userId"] {
-		hu.SendErr(w, http.StatusUnauthorized, errors.New("Not allowed access to other users"))
-		return
-	}
-	user := model.User{}
-	dbUpdateFields, _, err := hu.BindForUpdate(r, &user)
+//only the profile fields can be updated, the email, role and the credentials have their own endpoints
+//the input is bound to the profile fields only, thus the other columns of users cannot be written even by a crafted key
+func UserUpdate(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	input := struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	}{}
+	dbUpdateFields, _, err := httputil.BindForUpdate(r.Body, &input)
 	if err != nil {
-		hu.SendErr(w, http.StatusBadRequest, err)
-		return
+		return http.StatusBadRequest, err, nil
 	}
-	if statusCode, err := updateRecord(&user, dbUpdateFields, urlValues["userId"]); err != nil {
-		hu.SendErr(w, statusCode, err)
-	} else {
-		hu.Send(w, http.StatusOK, hu.M{"id": urlValues["userId"]})
+	user := model.User{FirstName: input.FirstName, LastName: input.LastName}
+	statusCode, err := updateRecord(&user, dbUpdateFields, urlValues["userId"], userId, session)
+	return statusCode, err, nil
+}
+
+//delete the user with all the records referencing the user, and reject all the tokens of the user
+func UserDelete(urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	if statusCode, err := getRecord(&model.User{}, urlValues["userId"], userId, policy.DELETE, session); err != nil {
+		return statusCode, err, nil
+	}
+
+	id := urlValues["userId"]
+	//the shares of the cats owned by the user are deleted with the cats by cat_shares_fk1
+	for _, sql := range []string{
+		"delete from cat_shares where user_id = ?",
+		"delete from cats where user_id = ?",
+		"delete from user_tokens where user_id = ?",
+		"delete from recovery_codes where user_id = ?",
+		"delete from user_identities where user_id = ?",
+		"delete from api_keys where user_id = ?",
+		"delete from user_sessions where user_id = ?",
+		"delete from export_jobs where user_id = ?",
+	} {
+		if _, err := session.Exec(sql, id); err != nil {
+			return http.StatusInternalServerError, err, nil
+		}
+	}
+	if statusCode, err := deleteRecord(&model.User{}, id, userId, session); err != nil {
+		return statusCode, err, nil
+	}
+
+	//the token version of the deleted user is never valid, thus clearing the cache rejects all the access tokens
+	//they are done after the commit, otherwise a concurrent request may cache the old version, or the archives are lost on rollback
+	txhook.AfterCommit(session, func() error {
+		return revocation.ClearTokenVersionCache(id)
+	})
+	txhook.AfterCommit(session, func() error {
+		return refresh.RevokeAll(id)
+	})
+	txhook.AfterCommit(session, func() error {
+		return export.RemoveArchives(id)
+	})
+	return http.StatusNoContent, nil, nil
+}
+
+//check if the user exists, without the object level privilege checking
+func getUser(id string, session *xorm.Session) (statusCode int, err error) {
+	if _, err := uuid.FromString(id); err != nil {
+		return http.StatusBadRequest, errUuidNotValid
+	}
+	if found, err := session.Id(id).Get(&model.User{}); err != nil {
+		return http.StatusInternalServerError, err
+	} else if found == false {
+		return http.StatusNotFound, errors.New("The user is not found.")
 	}
+	return http.StatusOK, nil
 }
-*/
 
 func UserCreate(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
 	user := struct {
-		model.User `xorm:"extends"`
-		Password   string `xorm:"-" json:"password" validate:"required"`
+		model.User  `xorm:"extends"`
+		Password    string `xorm:"-" json:"password" validate:"required"`
+		DeviceLabel string `xorm:"-" json:"deviceLabel" validate:"max=100"`
 	}{}
 
 	if err := httputil.Bind(r.Body, &user); err != nil {
@@ -55,12 +113,23 @@ func UserCreate(w http.ResponseWriter, r *http.Request, urlValues map[string]str
 		return
 	}
 	user.Id = uuid.NewV4().String()
+	//the role can only be granted by admin
+	user.Role = auth.ROLE_USER
+	//the email is verified by the token sent to the email
+	user.EmailVerified = false
+	//the TOTP is enabled after the user confirms the secret, see TotpEnroll and TotpConfirm
+	user.TotpEnabled = false
+	user.TotpSecret = ``
 
-	if digest, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost); err != nil {
+	if statusCode, err := checkPasswordPolicy("password", user.Password, user.User); err != nil {
+		middleware.SendError(w, statusCode, err)
+		return
+	}
+	if digest, err := password.Hash(user.Password); err != nil {
 		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	} else {
-		user.PasswordDigest = string(digest)
+		user.PasswordDigest = digest
 	}
 
 	session := db.NewSession()
@@ -70,23 +139,59 @@ func UserCreate(w http.ResponseWriter, r *http.Request, urlValues map[string]str
 	}
 	defer session.Close()
 
-	if statusCode, err := createRecord(&user, session); err != nil {
+	if statusCode, err := createRecord(&user, session); isUniqueViolation(err, "users_u1") {
+		middleware.Send(w, http.StatusConflict, map[string]string{"error": errEmailTaken.Error()})
+		return
+	} else if err != nil {
 		middleware.Send(w, statusCode, map[string]string{"error": err.Error()})
 		return
 	}
+	verifyToken, err := createUserToken(session, user.Id, PURPOSE_EMAIL_VERIFY, conf.EmailVerifyTokenLifetime)
+	if err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
 
 	if err := session.Commit(); err != nil {
 		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
 
-	if newToken, err := auth.Sign(user.Id); err != nil {
-		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	} else {
-		// update JWT Token
-		w.Header().Add("Authorization", newToken)
-		//allow CORS
-		w.Header().Set("Access-Control-Expose-Headers", "Authorization")
-		middleware.Send(w, http.StatusOK, map[string]string{"userId": user.Id})
+	//the user is already created, and he can ask for resending the email. Thus the failure is not returned
+	if err := sendVerifyEmail(user.Email, verifyToken); err != nil {
+		log.Println("Failed to send the verification email", err)
+	}
+
+	sendNewSession(w, r, db, user.User, user.DeviceLabel)
+}
+
+//change the role of other user, it is for admin only
+func UserRoleUpdate(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	var input struct {
+		Role string `json:"role" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		return http.StatusBadRequest, err, nil
+	}
+	if auth.IsValidRole(input.Role) == false {
+		return http.StatusBadRequest, errors.New("The role is invalid."), nil
+	}
+	if _, err := uuid.FromString(urlValues["userId"]); err != nil {
+		return http.StatusBadRequest, errUuidNotValid, nil
+	}
+
+	affected, err := session.Table("users").Where("id = ?", urlValues["userId"]).Cols("role").Update(map[string]interface{}{"role": input.Role})
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	if affected == 0 {
+		return http.StatusNotFound, errNotFound, nil
+	}
+
+	//the tokens carry the scopes of the old role, and the renewal keeps them. Thus all the tokens are revoked,
+	//and the user has to login again for the new role
+	if err := revokeAllTokens(session, urlValues["userId"]); err != nil {
+		return http.StatusInternalServerError, err, nil
 	}
+	return http.StatusNoContent, nil, nil
 }
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"meow/lib/httputil"
+	"meow/lib/mail"
+	"meow/lib/middleware"
+	"meow/lib/txhook"
+	"meow/model"
+
+	"github.com/go-xorm/xorm"
+)
+
+//verify the email with the token sent to the email
+//the client should refresh the access token afterward, to obtain the scopes of a verified user
+func UserVerify(w http.ResponseWriter, r *http.Request, urlValues map[string]string, db *xorm.Engine) {
+	var input struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if err := httputil.Bind(r.Body, &input); err != nil {
+		middleware.Send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	session := db.NewSession()
+	if err := session.Begin(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer session.Close()
+
+	userToken, statusCode, err := consumeUserToken(session, input.Token, PURPOSE_EMAIL_VERIFY)
+	if err != nil {
+		middleware.Send(w, statusCode, map[string]string{"error": err.Error()})
+		return
+	}
+	user := model.User{EmailVerified: true}
+	if _, err := session.Id(userToken.UserId).Cols("email_verified").Update(&user); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := session.Commit(); err != nil {
+		middleware.Send(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	middleware.Send(w, http.StatusNoContent, nil)
+}
+
+//send the verification email again, e.g. the previous one is expired
+func UserVerifyResend(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (int, error, interface{}) {
+	user := model.User{}
+	if found, err := session.Id(userId).Get(&user); err != nil {
+		return http.StatusInternalServerError, err, nil
+	} else if found == false {
+		return http.StatusNotFound, errNotFound, nil
+	}
+	if user.EmailVerified {
+		return http.StatusNoContent, nil, nil
+	}
+
+	token, err := createUserToken(session, user.Id, PURPOSE_EMAIL_VERIFY, conf.EmailVerifyTokenLifetime)
+	if err != nil {
+		return http.StatusInternalServerError, err, nil
+	}
+	//sent after the commit, thus the email never carries a token rolled back, and the transaction doesn't wait for the mail server
+	txhook.AfterCommit(session, func() error {
+		return sendVerifyEmail(user.Email, token)
+	})
+	return http.StatusNoContent, nil, nil
+}
+
+func sendVerifyEmail(email, token string) error {
+	body := "Please visit the following link to verify your email:\n\n" +
+		conf.EmailVerifyUrl + "?token=" + url.QueryEscape(token) + "\n\n" +
+		"The link will expire in " + conf.EmailVerifyTokenLifetime.String() + ".\n"
+	return mail.Send(email, "Verify your email", body)
+}
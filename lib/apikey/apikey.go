@@ -0,0 +1,85 @@
+//the API keys for the machine clients, e.g. the batch scripts
+//the key is sent in the Authorization header as the jwt token, it is distinguished by the prefix
+
+package apikey
+
+import (
+	"errors"
+	"strings"
+
+	"meow/lib/auth"
+	"meow/lib/randtoken"
+
+	"github.com/go-xorm/xorm"
+)
+
+const (
+	PREFIX = `meow_`
+	//the leading characters of the key stored in plain text, thus the user can recognize the key in the list
+	DISPLAY_PREFIX_LENGTH = 12
+)
+
+var (
+	ErrInvalidKey = errors.New("The API key is invalid or expired.")
+)
+
+var (
+	db *xorm.Engine
+)
+
+func Init(database *xorm.Engine) {
+	db = database
+}
+
+//generate a new key, only the digest should be stored
+func New() (key string, err error) {
+	token, err := randtoken.New()
+	if err != nil {
+		return ``, err
+	}
+	return PREFIX + token, nil
+}
+
+func IsApiKey(s string) bool {
+	return strings.HasPrefix(s, PREFIX)
+}
+
+func Digest(key string) string {
+	return randtoken.Digest(key)
+}
+
+func DisplayPrefix(key string) string {
+	return key[:DISPLAY_PREFIX_LENGTH]
+}
+
+//the scopes of the key are stored as a space separated string
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, ` `)
+}
+
+//look up the key, and return the claims equivalent to a jwt token
+//the scopes are limited by the current scopes of the user, thus the key loses the scopes revoked from the user
+func Authenticate(key string) (auth.Claims, error) {
+	row := struct {
+		Id            string
+		UserId        string
+		Scopes        string
+		Role          string
+		EmailVerified bool
+	}{}
+	found, err := db.Sql("select k.id, k.user_id, k.scopes, u.role, u.email_verified from api_keys k join users u on u.id = k.user_id where k.key_digest = ? and k.expire_time > now()", Digest(key)).Get(&row)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+	if found == false {
+		return auth.Claims{}, ErrInvalidKey
+	}
+
+	userScopes := auth.RemoveScopes(auth.UserScopes(row.Role, row.EmailVerified), auth.NON_DELEGABLE_SCOPES...)
+	return auth.Claims{
+		UserId:   row.UserId,
+		Role:     row.Role,
+		Scopes:   auth.IntersectScopes(strings.Fields(row.Scopes), userScopes),
+		ApiKeyId: row.Id,
+	}, nil
+}
@@ -0,0 +1,55 @@
+//the audit records written by the application, in addition to the records written by the triggers
+//meow_user has no privilege on the audit schema, the records are inserted by the SECURITY DEFINER functions in create_audit_trigger.sql
+//thus the application can append the records, but it can neither read nor change them, except reading the history of a user for the data export
+
+package audit
+
+import (
+	"errors"
+
+	"github.com/go-xorm/xorm"
+)
+
+var (
+	db *xorm.Engine
+)
+
+func Init(database *xorm.Engine) {
+	db = database
+}
+
+//record a request made by the admin as the impersonated user
+func Impersonation(actorId, userId, method, path, ipAddress string) error {
+	_, err := db.Exec("select audit.log_impersonation(?, ?, ?, ?, ?)", actorId, userId, method, path, ipAddress)
+	return err
+}
+
+//the audit history of the user in JSON, for the personal data export
+func UserHistory(userId string) ([]byte, error) {
+	results, err := db.Query("select audit.export_user_history(?) as history", userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, errors.New("No audit history is returned")
+	}
+	return results[0]["history"], nil
+}
+
+//the ways the user proves the identity before the password is changed
+const (
+	VERIFIED_BY_PASSWORD    = `password`
+	VERIFIED_BY_RECENT_AUTH = `recent-auth`
+	VERIFIED_BY_RESET_TOKEN = `reset-token`
+)
+
+//record the change of the password, in the transaction of the change. Thus the record exists if and only if the change is committed
+//the sessionId is empty if the change is not made in a login session, e.g. by the reset token
+func PasswordChange(session *xorm.Session, userId, sessionId, verifiedBy, ipAddress string) error {
+	var sessionIdArg interface{}
+	if sessionId != `` {
+		sessionIdArg = sessionId
+	}
+	_, err := session.Exec("select audit.log_password_change(?, ?, ?, ?)", userId, sessionIdArg, verifiedBy, ipAddress)
+	return err
+}
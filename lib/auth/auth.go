@@ -9,62 +9,204 @@ import (
 )
 
 var (
-	currentKey    *rsa.PrivateKey
-	oldKey        *rsa.PrivateKey
 	tokenLifeTime time.Duration
 )
 
+//the claims carried in the jwt token
+type Claims struct {
+	UserId string
+	//the token is rejected once the token version of the user is increased, e.g. the user logs out everywhere
+	TokenVersion int
+
+	Role   string
+	Scopes []string
+
+	//the login session of the token, it is empty for the API key and the token issued before the session is introduced
+	SessionId string
+
+	//the unique id of the token, it can be denylisted individually
+	TokenId string
+
+	//not empty if the request is authenticated by an API key instead of a jwt token
+	ApiKeyId string
+
+	//not empty if the token is issued for the admin to impersonate the user, it is the userId of the admin
+	ActorId string
+
+	//the time the token is signed, and the time the user logged in.
+	//the renewed token keeps the AuthTime, thus the session cannot be extended forever
+	IssueTime time.Time
+	AuthTime  time.Time
+}
+
+//the old key is the key used before the last key rotation.
+//it is accepted in verification for MaxTokenAge, so that the tokens signed by it are still valid until they expire
+//SetValidation should be called before, as the clock skew is part of MaxTokenAge
 func Init(current *rsa.PrivateKey, old *rsa.PrivateKey, lifeTime time.Duration) {
-	currentKey = current
-	oldKey = old
 	tokenLifeTime = lifeTime
+
+	keyLock.Lock()
+	currentKey = newSigningKey(current, time.Time{})
+	retiredKeys = nil
+	if old != nil {
+		retire(newSigningKey(old, time.Time{}), time.Now().Add(MaxTokenAge()))
+	}
+	buildVerifyKeys()
+	keyLock.Unlock()
 }
 
 // Please see the documentation: http://jwt.io/
-func Verify(authToken string) (userId string, err error) {
-	// parse and vertify the token string
+func Verify(authToken string) (claims Claims, err error) {
+	token, err := parse(authToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	//the token pending for the second factor is not an access token
+	if _, ok := token.Claims["mfaPending"]; ok {
+		return Claims{}, errors.New("Improper JWT Token")
+	}
+
+	if s, ok := token.Claims["userId"].(string); !ok {
+		return Claims{}, errors.New("Improper JWT Token")
+	} else {
+		claims.UserId = s
+	}
+
+	//the token issued before the token version is introduced doesn't have the claim, it is treated as version 0
+	switch v := token.Claims["tokenVersion"].(type) {
+	case nil:
+	case float64:
+		claims.TokenVersion = int(v)
+	default:
+		return Claims{}, errors.New("Improper JWT Token")
+	}
+
+	//the token issued before the role is introduced is a token of normal user
+	switch v := token.Claims["role"].(type) {
+	case nil:
+		claims.Role = ROLE_USER
+	case string:
+		claims.Role = v
+	default:
+		return Claims{}, errors.New("Improper JWT Token")
+	}
+	switch v := token.Claims["scopes"].(type) {
+	case nil:
+		claims.Scopes = ScopesOf(claims.Role)
+	case []interface{}:
+		for _, i := range v {
+			if scope, ok := i.(string); ok {
+				claims.Scopes = append(claims.Scopes, scope)
+			} else {
+				return Claims{}, errors.New("Improper JWT Token")
+			}
+		}
+	default:
+		return Claims{}, errors.New("Improper JWT Token")
+	}
+
+	if v, ok := token.Claims["actorId"]; ok {
+		if claims.ActorId, ok = v.(string); !ok || claims.ActorId == `` {
+			return Claims{}, errors.New("Improper JWT Token")
+		}
+	}
+
+	//the token issued before the jti is introduced has no id
+	claims.TokenId, _ = token.Claims["jti"].(string)
+
+	switch v := token.Claims["sessionId"].(type) {
+	case nil:
+	case string:
+		claims.SessionId = v
+	default:
+		return Claims{}, errors.New("Improper JWT Token")
+	}
+
+	//the token issued before the renewal policy is introduced is never renewed, it has zero IssueTime
+	for name, t := range map[string]*time.Time{"iat": &claims.IssueTime, "authTime": &claims.AuthTime} {
+		switch v := token.Claims[name].(type) {
+		case nil:
+		case float64:
+			*t = time.Unix(int64(v), 0)
+		default:
+			return Claims{}, errors.New("Improper JWT Token")
+		}
+	}
+	if claims.AuthTime.IsZero() {
+		claims.AuthTime = claims.IssueTime
+	}
+
+	return claims, nil
+}
+
+//parse and verify the token string
+func parse(authToken string) (*jwt.Token, error) {
 	token, err := jwt.Parse(authToken, func(t *jwt.Token) (interface{}, error) {
 		// make sure the JWT token is using RSA alg
 		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, errors.New("Unexpected signing method")
 		}
 
-		switch ts := t.Claims["exp"].(type) {
-		default:
-			return nil, errors.New("Improper JWT Token")
-		case float64:
-			timestamp := time.Unix(int64(ts), 0)
-			if timestamp.Before(time.Now()) {
-				return nil, errors.New("JWT Token has expired")
-			}
+		if err := validateRegisteredClaims(t.Claims); err != nil {
+			return nil, err
 		}
 
-		return &currentKey.PublicKey, nil
+		//pick the public key by the kid in the jwt header
+		kid, _ := t.Header["kid"].(string)
+		return getVerifyKey(kid)
 	})
+	//the jwt library checks exp and nbf again without the clock skew, such errors are ignored as they are checked above
+	if vErr, ok := err.(*jwt.ValidationError); ok && vErr.Errors&^(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) == 0 {
+		return token, nil
+	}
 	if err != nil {
-		return ``, err
+		return nil, err
 	}
 
 	if token.Valid == false { // make sure token is Valid
-		return ``, errors.New("Wrong jwt token")
+		return nil, errors.New("Wrong jwt token")
 	}
+	return token, nil
+}
 
-	if s, ok := token.Claims["userId"].(string); !ok {
-		return ``, errors.New("Improper JWT Token")
-	} else {
-		userId = s
-	}
+//sign a new access token. Zero AuthTime means the user logs in now
+func Sign(claims Claims) (authToken string, err error) {
+	return sign(claims, tokenLifeTime)
+}
 
-	return userId, nil
+//sign a token for the admin to impersonate the user, the ActorId must be set
+//it has its own lifetime, and it is never renewed
+func SignImpersonation(claims Claims, lifeTime time.Duration) (authToken string, err error) {
+	if claims.ActorId == `` {
+		return ``, errors.New("The actor of the impersonation is missing")
+	}
+	return sign(claims, lifeTime)
 }
 
-func Sign(userId string) (authToken string, err error) {
-	token := jwt.New(jwt.SigningMethodRS512)
+func sign(claims Claims, lifeTime time.Duration) (authToken string, err error) {
+	now := time.Now()
+	if claims.AuthTime.IsZero() {
+		claims.AuthTime = now
+	}
+
+	key := getSigningKey()
+	token := newToken(key, now)
 
 	// Set some claims
-	token.Claims["userId"] = userId
-	token.Claims["exp"] = time.Now().Add(tokenLifeTime).Unix()
+	token.Claims["userId"] = claims.UserId
+	token.Claims["tokenVersion"] = claims.TokenVersion
+	token.Claims["role"] = claims.Role
+	token.Claims["scopes"] = claims.Scopes
+	if claims.SessionId != `` {
+		token.Claims["sessionId"] = claims.SessionId
+	}
+	if claims.ActorId != `` {
+		token.Claims["actorId"] = claims.ActorId
+	}
+	token.Claims["authTime"] = claims.AuthTime.Unix()
+	token.Claims["exp"] = expireTime(now, claims.AuthTime, lifeTime).Unix()
 
 	// Sign and get the complete encoded token as a string
-	return token.SignedString(currentKey)
+	return token.SignedString(key.privateKey)
 }
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	//the size of the generated key, and the minimum size of the loaded key
+	KEY_BITS = 2048
+)
+
+//read the RSA private key in PEM format, and make sure it can sign the tokens
+//thus a broken or truncated key file is never swapped in
+func LoadKeyFile(path string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(b)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	if err := key.Validate(); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	if key.N.BitLen() < KEY_BITS {
+		return nil, errors.New(path + ": the key has " + strconv.Itoa(key.N.BitLen()) + " bits only, at least " + strconv.Itoa(KEY_BITS) + " bits are required")
+	}
+
+	//sign and verify a probe in the same way as RS512
+	digest := sha512.Sum512([]byte(`probe`))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA512, digest[:])
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA512, digest[:], signature); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return key, nil
+}
+
+func GenerateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, KEY_BITS)
+}
+
+//write the key in PEM format. The file is written to a temporary file and then renamed
+//thus the server never reads a partially written key file
+func WriteKeyFile(path string, key *rsa.PrivateKey) error {
+	b := pem.EncodeToMemory(&pem.Block{Type: `RSA PRIVATE KEY`, Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+`.tmp`)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
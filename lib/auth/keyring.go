@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"meow/lib/jose"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+//a RSA key used for signing the jwt token, identified by the kid in the jwt header
+type signingKey struct {
+	kid        string
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+
+	//zero value means the key is the current key.
+	//a retired key is no longer used for signing, but it is still accepted in verification until expireTime
+	expireTime time.Time
+}
+
+var (
+	keyLock     sync.RWMutex
+	currentKey  *signingKey
+	retiredKeys []*signingKey
+
+	//the keys accepted in verification by kid, rebuilt whenever the keyring changes
+	//thus the verification of each request is a map lookup, instead of scanning and deriving the keys
+	verifyKeys map[string]*signingKey
+)
+
+func newSigningKey(key *rsa.PrivateKey, expireTime time.Time) *signingKey {
+	return &signingKey{kid: KeyId(&key.PublicKey), privateKey: key, publicKey: &key.PublicKey, expireTime: expireTime}
+}
+
+//the kid is the JWK thumbprint of the public key (RFC 7638)
+//thus every instance of the server derives the same kid from the same key file
+func KeyId(key *rsa.PublicKey) string {
+	//the members must be in lexicographic order and without any whitespace
+	s := `{"e":"` + jose.EncodeBigInt(big.NewInt(int64(key.E))) + `","kty":"RSA","n":"` + jose.EncodeBigInt(key.N) + `"}`
+	sum := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+//replace the current signing key by newKey.
+//the previous current key is retired, tokens signed by it are still accepted within the gracePeriod
+//normally gracePeriod should not be shorter than the token lifetime, otherwise the users will be logged out
+func Rotate(newKey *rsa.PrivateKey, gracePeriod time.Duration) {
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
+	key := newSigningKey(newKey, time.Time{})
+	if currentKey != nil {
+		if currentKey.kid == key.kid {
+			//same key, nothing to do
+			return
+		}
+		retire(currentKey, time.Now().Add(gracePeriod))
+	}
+	currentKey = key
+	buildVerifyKeys()
+}
+
+//replace the keys by the keys reloaded from the key files, e.g. after the key rotation by the admin command
+//the previous current key is retired, and the old key is accepted within the grace period if it is not known yet
+//the keys are swapped at once, thus no request sees a partial state
+func Reload(current *rsa.PrivateKey, old *rsa.PrivateKey) {
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
+	expireTime := time.Now().Add(MaxTokenAge())
+	key := newSigningKey(current, time.Time{})
+	if currentKey != nil && currentKey.kid != key.kid {
+		retire(currentKey, expireTime)
+	}
+	currentKey = key
+
+	if old != nil {
+		oldKey := newSigningKey(old, time.Time{})
+		if _, known := verifyKeys[oldKey.kid]; known == false && oldKey.kid != key.kid {
+			retire(oldKey, expireTime)
+		}
+	}
+	buildVerifyKeys()
+}
+
+func CurrentKeyId() string {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+	return currentKey.kid
+}
+
+//must be called with keyLock held
+func retire(key *signingKey, expireTime time.Time) {
+	//remove the expired keys, and the previous entry of the same key
+	keys := []*signingKey{}
+	now := time.Now()
+	for _, k := range retiredKeys {
+		if k.expireTime.After(now) && k.kid != key.kid {
+			keys = append(keys, k)
+		}
+	}
+	retiredKeys = append(keys, &signingKey{kid: key.kid, privateKey: key.privateKey, publicKey: key.publicKey, expireTime: expireTime})
+}
+
+//must be called with keyLock held, after the current key or the retired keys are changed
+func buildVerifyKeys() {
+	verifyKeys = map[string]*signingKey{}
+	for _, k := range retiredKeys {
+		verifyKeys[k.kid] = k
+	}
+	if currentKey != nil {
+		verifyKeys[currentKey.kid] = currentKey
+	}
+}
+
+func getSigningKey() *signingKey {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+	return currentKey
+}
+
+//find the public key for the kid in the jwt header.
+//empty kid means the token is issued before the kid is introduced, the current key is used in such case
+func getVerifyKey(kid string) (*rsa.PublicKey, error) {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+
+	if currentKey == nil {
+		return nil, errors.New("No signing key is loaded")
+	}
+	if kid == `` {
+		return currentKey.publicKey, nil
+	}
+
+	//the retired key is kept in the map after its grace period, until the next rotation
+	if k, ok := verifyKeys[kid]; ok && (k.expireTime.IsZero() || k.expireTime.After(time.Now())) {
+		return k.publicKey, nil
+	}
+	return nil, errors.New("Unknown JWT signing key")
+}
+
+//a public key in JSON Web Key format (RFC 7517)
+type JsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+//the public keys which are accepted in verification, i.e. the current key and the retired keys within grace period
+//thus other services can verify the tokens without the private key
+func JsonWebKeys() []JsonWebKey {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+
+	keys := []JsonWebKey{}
+	if currentKey != nil {
+		keys = append(keys, toJsonWebKey(currentKey))
+	}
+	now := time.Now()
+	for _, k := range retiredKeys {
+		if k.expireTime.After(now) {
+			keys = append(keys, toJsonWebKey(k))
+		}
+	}
+	return keys
+}
+
+func toJsonWebKey(key *signingKey) JsonWebKey {
+	publicKey := key.publicKey
+	return JsonWebKey{
+		Kty: `RSA`,
+		Use: `sig`,
+		Alg: jwt.SigningMethodRS512.Alg(),
+		Kid: key.kid,
+		N:   jose.EncodeBigInt(publicKey.N),
+		E:   jose.EncodeBigInt(big.NewInt(int64(publicKey.E))),
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+//the period for the user to enter the second factor after the password is verified
+const MFA_TOKEN_LIFETIME = 5 * time.Minute
+
+//the longest period a token pending for the second factor can be accepted
+func MaxMfaTokenAge() time.Duration {
+	return MFA_TOKEN_LIFETIME + validation.ClockSkew
+}
+
+//the claims of the token pending for the second factor
+type MfaPending struct {
+	UserId string
+	//the jti claim, the token is exchanged once only
+	TokenId string
+	//the token is rejected once the token version of the user is increased, e.g. by a password reset
+	TokenVersion int
+}
+
+//sign a token proving the password of the user is verified, it is exchanged for the access token with the second factor
+//it is rejected by Verify, thus it cannot be used as an access token
+func SignMfaPending(userId string, tokenVersion int) (string, error) {
+	key := getSigningKey()
+	token := newToken(key, time.Now())
+
+	token.Claims["userId"] = userId
+	token.Claims["tokenVersion"] = tokenVersion
+	token.Claims["mfaPending"] = true
+	token.Claims["exp"] = time.Now().Add(MFA_TOKEN_LIFETIME).Unix()
+
+	return token.SignedString(key.privateKey)
+}
+
+//verify the token signed by SignMfaPending
+//the caller should check the token version, and mark the token id as used
+func VerifyMfaPending(mfaToken string) (MfaPending, error) {
+	token, err := parse(mfaToken)
+	if err != nil {
+		return MfaPending{}, err
+	}
+	if pending, _ := token.Claims["mfaPending"].(bool); pending == false {
+		return MfaPending{}, errors.New("Improper MFA Token")
+	}
+
+	m := MfaPending{}
+	var ok bool
+	if m.UserId, ok = token.Claims["userId"].(string); !ok {
+		return MfaPending{}, errors.New("Improper MFA Token")
+	}
+	if m.TokenId, ok = token.Claims["jti"].(string); !ok || m.TokenId == `` {
+		return MfaPending{}, errors.New("Improper MFA Token")
+	}
+	if v, ok := token.Claims["tokenVersion"].(float64); !ok {
+		return MfaPending{}, errors.New("Improper MFA Token")
+	} else {
+		m.TokenVersion = int(v)
+	}
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"meow/lib/jose"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/satori/go.uuid"
+)
+
+//the validation of the registered claims (RFC 7519), shared by all the tokens signed by us
+type Validation struct {
+	//empty string means the claim is neither set nor checked
+	//use different values in each environment, thus the tokens of the staging environment are rejected in production
+	Issuer   string
+	Audience string
+
+	//the tolerance of the clock difference between the servers, applied on exp, nbf and iat
+	ClockSkew time.Duration
+}
+
+var (
+	validation Validation
+)
+
+func SetValidation(v Validation) {
+	validation = v
+}
+
+//the longest period a token can be accepted, thus a denylisted token id can be forgotten afterwards
+func MaxTokenAge() time.Duration {
+	return tokenLifeTime + validation.ClockSkew
+}
+
+//create a token with the registered claims, the caller sets the exp and the private claims
+func newToken(key *signingKey, now time.Time) *jwt.Token {
+	token := jwt.New(jwt.SigningMethodRS512)
+	token.Header["kid"] = key.kid
+
+	if validation.Issuer != `` {
+		token.Claims["iss"] = validation.Issuer
+	}
+	if validation.Audience != `` {
+		token.Claims["aud"] = validation.Audience
+	}
+	token.Claims["iat"] = now.Unix()
+	token.Claims["nbf"] = now.Unix()
+	token.Claims["jti"] = uuid.NewV4().String()
+	return token
+}
+
+//check the registered claims before the signature is verified
+//the token issued before the claims are introduced has no iat and nbf, which are not required
+func validateRegisteredClaims(claims map[string]interface{}) error {
+	if validation.Issuer != `` {
+		if iss, _ := claims["iss"].(string); iss != validation.Issuer {
+			return errors.New("The JWT Token is issued by other issuer")
+		}
+	}
+	if validation.Audience != `` && jose.HasAudience(claims["aud"], validation.Audience) == false {
+		return errors.New("The JWT Token is not issued for this audience")
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok {
+		return errors.New("Improper JWT Token")
+	} else if time.Unix(int64(exp), 0).Add(validation.ClockSkew).Before(now) {
+		return errors.New("JWT Token has expired")
+	}
+	for _, name := range []string{"nbf", "iat"} {
+		switch v := claims[name].(type) {
+		case nil:
+		case float64:
+			if time.Unix(int64(v), 0).After(now.Add(validation.ClockSkew)) {
+				return errors.New("JWT Token is not valid yet")
+			}
+		default:
+			return errors.New("Improper JWT Token")
+		}
+	}
+	return nil
+}
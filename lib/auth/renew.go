@@ -0,0 +1,51 @@
+package auth
+
+import "time"
+
+//the policy of renewing the access token in the middleware
+//the token is renewed only when it gets old, thus most requests don't pay for a RSA signature
+type RenewPolicy struct {
+	//the token is renewed once its age is over this fraction of the token lifetime. Zero disables the renewal
+	Fraction float64
+	//the renewed token never lives beyond the login time + MaxSessionLifetime. Zero means no limit
+	MaxSessionLifetime time.Duration
+}
+
+var (
+	renewPolicy RenewPolicy
+)
+
+func SetRenewPolicy(p RenewPolicy) {
+	renewPolicy = p
+}
+
+//the expire time of a token signed at now, capped by the absolute session lifetime
+func expireTime(now, authTime time.Time, lifeTime time.Duration) time.Time {
+	exp := now.Add(lifeTime)
+	if renewPolicy.MaxSessionLifetime > 0 {
+		if limit := authTime.Add(renewPolicy.MaxSessionLifetime); limit.Before(exp) {
+			return limit
+		}
+	}
+	return exp
+}
+
+//sign a new token for the claims if the token is due for renewal
+//renewed is false if the token is still fresh, or the renewal cannot extend the token due to the session lifetime
+func Renew(claims Claims) (authToken string, renewed bool, err error) {
+	if renewPolicy.Fraction <= 0 || claims.IssueTime.IsZero() || claims.ApiKeyId != `` || claims.ActorId != `` {
+		return ``, false, nil
+	}
+
+	now := time.Now()
+	threshold := time.Duration(float64(tokenLifeTime) * renewPolicy.Fraction)
+	if now.Sub(claims.IssueTime) < threshold {
+		return ``, false, nil
+	}
+	if expireTime(now, claims.AuthTime, tokenLifeTime).After(expireTime(claims.IssueTime, claims.AuthTime, tokenLifeTime)) == false {
+		return ``, false, nil
+	}
+
+	authToken, err = Sign(claims)
+	return authToken, err == nil, err
+}
@@ -0,0 +1,107 @@
+package auth
+
+//the roles of the users, stored in users.role
+const (
+	ROLE_USER    string = `user`
+	ROLE_SUPPORT string = `support`
+	ROLE_ADMIN   string = `admin`
+
+	//the internal service authenticated by the client certificate, its scopes are configured per service
+	//it is not in roleScopes, thus it cannot be granted to the users
+	ROLE_SERVICE string = `service`
+)
+
+//the scopes carried in the jwt token, the routes declare the scopes they required
+const (
+	SCOPE_CAT_READ  string = `cat:read`
+	SCOPE_CAT_WRITE string = `cat:write`
+
+	//manage the account of the user himself, e.g. the sessions, TOTP and API keys
+	SCOPE_ACCOUNT string = `account`
+
+	//read the data of other users, e.g. for customer support
+	SCOPE_USER_READ string = `user:read`
+	//manage other users, e.g. change the role
+	SCOPE_USER_ADMIN string = `user:admin`
+)
+
+var allScopes = []string{SCOPE_CAT_READ, SCOPE_CAT_WRITE, SCOPE_ACCOUNT, SCOPE_USER_READ, SCOPE_USER_ADMIN}
+
+var roleScopes = map[string][]string{
+	ROLE_USER:    []string{SCOPE_CAT_READ, SCOPE_CAT_WRITE, SCOPE_ACCOUNT},
+	ROLE_SUPPORT: []string{SCOPE_CAT_READ, SCOPE_CAT_WRITE, SCOPE_ACCOUNT, SCOPE_USER_READ},
+	ROLE_ADMIN:   []string{SCOPE_CAT_READ, SCOPE_CAT_WRITE, SCOPE_ACCOUNT, SCOPE_USER_READ, SCOPE_USER_ADMIN},
+}
+
+//the scopes which cannot be delegated to the API keys, nor granted to the impersonation tokens
+var NON_DELEGABLE_SCOPES = []string{SCOPE_ACCOUNT}
+
+//the scopes granted to the role. Unknown role has no scope
+func ScopesOf(role string) []string {
+	scopes := []string{}
+	return append(scopes, roleScopes[role]...)
+}
+
+//the scopes granted to the user. The user can read only, until the email is verified
+func UserScopes(role string, emailVerified bool) []string {
+	scopes := ScopesOf(role)
+	if emailVerified {
+		return scopes
+	}
+	return RemoveScopes(scopes, SCOPE_CAT_WRITE)
+}
+
+//the scopes which are in both a and b
+func IntersectScopes(a, b []string) []string {
+	output := []string{}
+	for _, s := range a {
+		for _, t := range b {
+			if s == t {
+				output = append(output, s)
+				break
+			}
+		}
+	}
+	return output
+}
+
+//return the scopes without the removed scopes
+func RemoveScopes(scopes []string, removed ...string) []string {
+	output := []string{}
+	for _, s := range scopes {
+		keep := true
+		for _, r := range removed {
+			if s == r {
+				keep = false
+			}
+		}
+		if keep {
+			output = append(output, s)
+		}
+	}
+	return output
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+//true if the scope is one of the scopes above, e.g. for checking the configured scopes of the services
+func IsValidScope(scope string) bool {
+	for _, s := range allScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+//the tokens in cookies for the browser, as an alternative of the Authorization header
+//the access token and the refresh token are HttpOnly, thus they cannot be stolen by XSS.
+//the unsafe requests must carry the CSRF token in the header. The token is the HMAC of the login session id,
+//thus a token planted by another site, e.g. by a cookie of a sibling subdomain, is not accepted for the session of the victim
+
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	ACCESS_TOKEN  = `meow_access`
+	REFRESH_TOKEN = `meow_refresh`
+	//readable by javascript, the client copies it to the CSRF_HEADER
+	CSRF_TOKEN = `meow_csrf`
+
+	CSRF_HEADER = `X-CSRF-Token`
+	//the client asks for the cookie mode in the login requests by this header
+	MODE_HEADER = `X-Auth-Mode`
+	MODE_COOKIE = `cookie`
+
+	//the refresh token is sent to the auth endpoints only
+	REFRESH_TOKEN_PATH = `/v1/auth`
+
+	//the state of the OpenID Connect login, it binds the callback to the browser starting the login
+	OIDC_STATE = `meow_oidc_state`
+	//the one-time code handing over the login from the callback to the client
+	OIDC_HANDOVER = `meow_oidc_handover`
+	OIDC_PATH     = `/v1/auth/oidc`
+)
+
+var (
+	ErrCsrfToken = errors.New("The CSRF token is missing or incorrect.")
+)
+
+type Config struct {
+	//false for the local development over http only
+	Secure   bool
+	SameSite http.SameSite
+	//empty string means the host of the request
+	Domain string
+	//the lifetime of the refresh token cookie, the other cookies end with the browser session
+	RefreshTokenLifetime time.Duration
+	//the key of the HMAC deriving the CSRF token from the session id
+	CsrfSecret []byte
+}
+
+var (
+	conf Config
+)
+
+func Init(c Config) {
+	conf = c
+}
+
+//true if the client asks for the cookie mode
+func IsRequested(r *http.Request) bool {
+	return r.Header.Get(MODE_HEADER) == MODE_COOKIE
+}
+
+//set the cookies after login or refresh. Empty refreshToken leaves the refresh token cookie unchanged
+func SetTokens(w http.ResponseWriter, accessToken string, refreshToken string, csrfToken string) {
+	SetAccessToken(w, accessToken)
+	if refreshToken != `` {
+		http.SetCookie(w, newCookie(REFRESH_TOKEN, refreshToken, REFRESH_TOKEN_PATH, true, int(conf.RefreshTokenLifetime/time.Second)))
+	}
+	http.SetCookie(w, newCookie(CSRF_TOKEN, csrfToken, `/`, false, 0))
+}
+
+//replace the access token, e.g. the token is renewed by the middleware
+func SetAccessToken(w http.ResponseWriter, accessToken string) {
+	http.SetCookie(w, newCookie(ACCESS_TOKEN, accessToken, `/`, true, 0))
+}
+
+//remove all the cookies, e.g. the user logs out
+func Clear(w http.ResponseWriter) {
+	http.SetCookie(w, newCookie(ACCESS_TOKEN, ``, `/`, true, -1))
+	http.SetCookie(w, newCookie(REFRESH_TOKEN, ``, REFRESH_TOKEN_PATH, true, -1))
+	http.SetCookie(w, newCookie(CSRF_TOKEN, ``, `/`, false, -1))
+}
+
+//set the HttpOnly cookie of the OpenID Connect login, empty value removes the cookie
+//it is always SameSite=Lax, as the callback is a top-level navigation from the identity provider, the strict cookie is not sent
+func SetOidc(w http.ResponseWriter, name string, value string, lifetime time.Duration) {
+	c := newCookie(name, value, OIDC_PATH, true, int(lifetime/time.Second))
+	if value == `` {
+		c.MaxAge = -1
+	}
+	c.SameSite = http.SameSiteLaxMode
+	http.SetCookie(w, c)
+}
+
+func newCookie(name, value, path string, httpOnly bool, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   conf.Domain,
+		MaxAge:   maxAge,
+		Secure:   conf.Secure,
+		HttpOnly: httpOnly,
+		SameSite: conf.SameSite,
+	}
+}
+
+//the value of the cookie, empty string if the cookie is absent
+func Get(r *http.Request, name string) string {
+	if c, err := r.Cookie(name); err == nil {
+		return c.Value
+	}
+	return ``
+}
+
+//the safe methods don't change anything, thus they don't need the CSRF token
+func IsSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+//the CSRF token of the login session, it is the same for all the access tokens and refresh tokens of the session
+func CsrfToken(sessionId string) string {
+	mac := hmac.New(sha256.New, conf.CsrfSecret)
+	mac.Write([]byte(`csrf-` + sessionId))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//the request authenticated by the cookie must carry the CSRF token of its session in the header
+//the other sites can send the cookies by a form post, but they cannot read the CSRF cookie for setting the header
+//the session id should be taken from the verified token, not from the request
+func CheckCsrf(r *http.Request, sessionId string) bool {
+	if IsSafeMethod(r.Method) {
+		return true
+	}
+	if sessionId == `` {
+		return false
+	}
+	return hmac.Equal([]byte(CsrfToken(sessionId)), []byte(r.Header.Get(CSRF_HEADER)))
+}
@@ -0,0 +1,40 @@
+package cookie
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCsrf(t *testing.T) {
+	Init(Config{CsrfSecret: []byte(`meow_csrf_secret_for_testing_only`)})
+
+	token := CsrfToken(`session-a`)
+	if token != CsrfToken(`session-a`) {
+		t.Fatal("the token of the same session is changed")
+	}
+	if token == CsrfToken(`session-b`) {
+		t.Fatal("the sessions have the same token")
+	}
+
+	cases := []struct {
+		method    string
+		header    string
+		sessionId string
+		ok        bool
+	}{
+		{`GET`, ``, `session-a`, true},
+		{`POST`, token, `session-a`, true},
+		{`POST`, ``, `session-a`, false},
+		{`POST`, token, `session-b`, false},
+		{`POST`, token, ``, false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, `/v1/cats`, nil)
+		if c.header != `` {
+			r.Header.Set(CSRF_HEADER, c.header)
+		}
+		if ok := CheckCsrf(r, c.sessionId); ok != c.ok {
+			t.Errorf("%s with header %q for %q: expected %v, got %v", c.method, c.header, c.sessionId, c.ok, ok)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+//the personal data export, the archive is built by the worker in background, thus a large account doesn't block the request
+//the jobs are queued in the export_jobs table and claimed by "for update skip locked", thus every server can run the worker
+//the archives are stored as <dir>/<userId>/<jobId>.zip, the directory should be shared by the servers
+
+package export
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+//the status of the export jobs
+const (
+	STATUS_PENDING = `pending`
+	STATUS_RUNNING = `running`
+	STATUS_DONE    = `done`
+	STATUS_FAILED  = `failed`
+	//the archive is deleted after its lifetime
+	STATUS_EXPIRED = `expired`
+)
+
+const (
+	//the worker checks the queue in this period, in case it is not notified, e.g. the job is created on another server
+	POLL_PERIOD = time.Minute
+	//the running job is claimed again after this period, e.g. the server crashed in the middle of the job
+	STALE_PERIOD = time.Hour
+)
+
+//write the files of the user into the archive
+type Builder func(userId string, archive *zip.Writer) error
+
+var (
+	db              *xorm.Engine
+	dir             string
+	archiveLifetime time.Duration
+	builder         Builder
+
+	wake = make(chan struct{}, 1)
+)
+
+func Init(database *xorm.Engine, directory string, lifetime time.Duration, b Builder) {
+	db = database
+	dir = directory
+	archiveLifetime = lifetime
+	builder = b
+}
+
+func ArchivePath(userId, jobId string) string {
+	return filepath.Join(dir, userId, jobId+".zip")
+}
+
+//remove all the archives of the user, e.g. the user is deleted
+func RemoveArchives(userId string) error {
+	return os.RemoveAll(filepath.Join(dir, userId))
+}
+
+//wake up the worker of this server, e.g. a job is just created. It never blocks
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+//run the worker forever, it should be called in a goroutine
+func Run() {
+	ticker := time.NewTicker(POLL_PERIOD)
+	for {
+		if err := removeExpired(); err != nil {
+			log.Println("Failed to remove the expired export archives:", err)
+		}
+		for {
+			found, err := runOne()
+			if err != nil {
+				log.Println("Failed to run the export job:", err)
+			}
+			if found == false || err != nil {
+				break
+			}
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+//claim a job and build its archive, false is returned if no job is waiting
+//the failure of building the archive is recorded in the job, it is not returned
+func runOne() (bool, error) {
+	results, err := db.Query(`update export_jobs set status = ?, start_time = now() where id = (
+			select id from export_jobs where status = ? or (status = ? and start_time < ?)
+			order by create_time limit 1 for update skip locked
+		) returning id, user_id`, STATUS_RUNNING, STATUS_PENDING, STATUS_RUNNING, time.Now().Add(-STALE_PERIOD))
+	if err != nil {
+		return false, err
+	}
+	if len(results) == 0 {
+		return false, nil
+	}
+	jobId, userId := string(results[0]["id"]), string(results[0]["user_id"])
+
+	if err := build(userId, jobId); err != nil {
+		log.Println("Failed to build the export archive", jobId, err)
+		_, err = db.Exec("update export_jobs set status = ?, finish_time = now() where id = ? and status = ?", STATUS_FAILED, jobId, STATUS_RUNNING)
+		return true, err
+	}
+	result, err := db.Exec("update export_jobs set status = ?, finish_time = now(), expire_time = ? where id = ? and status = ?",
+		STATUS_DONE, time.Now().Add(archiveLifetime), jobId, STATUS_RUNNING)
+	if err != nil {
+		return true, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return true, err
+	}
+	//the job is deleted with the user while building, RemoveArchives may have run before the archive is renamed
+	if affected == 0 {
+		if err := os.Remove(ArchivePath(userId, jobId)); err != nil && os.IsNotExist(err) == false {
+			return true, err
+		}
+		//fails if the user directory is not empty, e.g. another job of the same user is finishing
+		os.Remove(filepath.Join(dir, userId))
+	}
+	return true, nil
+}
+
+//the archive is written to a temp file and renamed, thus a half-written archive is never downloaded
+func build(userId, jobId string) error {
+	userDir := filepath.Join(dir, userId)
+	if err := os.MkdirAll(userDir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(userDir, jobId+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	archive := zip.NewWriter(f)
+	if err := builder(userId, archive); err != nil {
+		f.Close()
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), ArchivePath(userId, jobId))
+}
+
+//delete the archives over their lifetime, the jobs are kept as the history of the exports
+func removeExpired() error {
+	results, err := db.Query("update export_jobs set status = ? where status = ? and expire_time < now() returning id, user_id", STATUS_EXPIRED, STATUS_DONE)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := os.Remove(ArchivePath(string(r["user_id"]), string(r["id"]))); err != nil && os.IsNotExist(err) == false {
+			log.Println("Failed to remove the export archive", string(r["id"]), err)
+		}
+	}
+	return nil
+}
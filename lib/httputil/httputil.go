@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"net"
+	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
@@ -13,10 +15,29 @@ import (
 	xormCore "github.com/go-xorm/core"
 )
 
-var columnNameMapper xormCore.IMapper
+var (
+	columnNameMapper xormCore.IMapper
+	clientIpHeader   string
+)
 
-func Init(mapper xormCore.IMapper) {
+//ipHeader is the http header storing the client ip set by the reverse proxy, e.g. X-Real-IP
+//empty string means the server is exposed directly, and the remote address is the client ip
+func Init(mapper xormCore.IMapper, ipHeader string) {
 	columnNameMapper = mapper
+	clientIpHeader = ipHeader
+}
+
+//the ip address of the client who sent the request
+func ClientIp(r *http.Request) string {
+	if clientIpHeader != `` {
+		if ip := strings.TrimSpace(r.Header.Get(clientIpHeader)); ip != `` {
+			return ip
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
 }
 
 // bind the http request to a struct. JSON, form, XML are supported
@@ -97,7 +118,8 @@ func convertToFieldName(obj interface{}, jsonFieldName []string) (dbFieldNames m
 		fieldType := immutableType.Field(i)
 		jsonName := getJsonTagName(&fieldType)
 
-		if field.CanSet() && containValidateTag(&fieldType, []string{`fixed`, `zerotime`}) == false && jsonName != `` {
+		//the field with json tag "-" is never in the input, e.g. the password digest
+		if field.CanSet() && containValidateTag(&fieldType, []string{`fixed`, `zerotime`}) == false && jsonName != `` && jsonName != `-` {
 			m1[jsonName] = GetXormColName(&fieldType)
 			m2[jsonName] = fieldType.Name
 		}
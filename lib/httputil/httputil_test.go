@@ -0,0 +1,27 @@
+package httputil
+
+import (
+	"testing"
+
+	"meow/model"
+
+	xormCore "github.com/go-xorm/core"
+)
+
+func TestConvertToFieldNameSkipsHiddenFields(t *testing.T) {
+	Init(xormCore.SnakeMapper{}, ``)
+
+	//the fields tagged json:"-" must not be reachable by the key "-", e.g. the token version
+	dbFieldNames, fieldNames := convertToFieldName(&model.User{}, []string{`-`, `firstName`})
+	if len(fieldNames) != 1 || fieldNames[`FirstName`] == false {
+		t.Errorf("unexpected struct fields %v", fieldNames)
+	}
+	if len(dbFieldNames) != 1 {
+		t.Errorf("unexpected columns %v", dbFieldNames)
+	}
+
+	//the fixed fields are not updatable
+	if _, fieldNames := convertToFieldName(&model.User{}, []string{`role`, `email`, `totpEnabled`}); len(fieldNames) != 0 {
+		t.Errorf("unexpected struct fields %v", fieldNames)
+	}
+}
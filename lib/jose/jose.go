@@ -0,0 +1,47 @@
+//the helpers of the JSON Web Token and the JSON Web Key (RFC 7517), shared by the issuer in lib/auth and the relying party in lib/oidc
+
+package jose
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+//the big integer in the JSON Web Key, e.g. the modulus and the exponent, is base64url encoded without padding
+func EncodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+//convert the modulus and exponent in the JSON Web Key to the public key
+func RsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(eBytes)
+	if exponent.IsInt64() == false || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("The exponent of the key is too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}, nil
+}
+
+//the aud claim is either a string or an array of strings
+func HasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, _ := a.(string); s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
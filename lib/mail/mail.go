@@ -0,0 +1,106 @@
+//sending email to the users, the sender is pluggable
+//SmtpSender is for production, FileSender and MemorySender are for development and testing
+
+package mail
+
+import (
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(msg Message) error
+}
+
+var (
+	sender Sender
+	from   string
+)
+
+//from is the address of the sender, e.g. no-reply@meow.com
+func Init(s Sender, fromAddress string) {
+	sender = s
+	from = fromAddress
+}
+
+//the body is plain text
+func Send(to, subject, body string) error {
+	return sender.Send(Message{To: to, Subject: subject, Body: body})
+}
+
+//the message in RFC 5322 format
+func format(msg Message) []byte {
+	//remove the line breaks, thus the user input cannot inject extra headers
+	clean := func(s string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	}
+	return []byte("From: " + clean(from) + "\r\n" +
+		"To: " + clean(msg.To) + "\r\n" +
+		"Subject: " + clean(msg.Subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		msg.Body)
+}
+
+//send the email through the smtp server, the username can be empty if the server requires no authentication
+type SmtpSender struct {
+	Addr     string
+	Username string
+	Password string
+}
+
+func (s SmtpSender) Send(msg Message) error {
+	var a smtp.Auth = nil
+	if s.Username != `` {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		a = smtp.PlainAuth(``, s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, a, from, []string{msg.To}, format(msg))
+}
+
+//write each email as a .eml file in the directory, for development
+type FileSender struct {
+	Dir string
+}
+
+func (s FileSender) Send(msg Message) error {
+	name := time.Now().Format("20060102-150405") + `-` + uuid.NewV4().String() + `.eml`
+	return ioutil.WriteFile(filepath.Join(s.Dir, name), format(msg), 0600)
+}
+
+//keep the emails in memory, for testing
+type MemorySender struct {
+	lock     sync.Mutex
+	messages []Message
+}
+
+func (s *MemorySender) Send(msg Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+//the emails sent so far
+func (s *MemorySender) Messages() []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Message{}, s.messages...)
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemorySender(t *testing.T) {
+	s := &MemorySender{}
+	Init(s, `no-reply@meow.com`)
+
+	if err := Send(`susan@meow.com`, `Reset your password`, `the link`); err != nil {
+		t.Fatal(err)
+	}
+	messages := s.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if m := messages[0]; m.To != `susan@meow.com` || m.Subject != `Reset your password` || m.Body != `the link` {
+		t.Errorf("unexpected message %+v", m)
+	}
+
+	//the returned slice is a copy
+	messages[0].To = `changed`
+	if s.Messages()[0].To != `susan@meow.com` {
+		t.Error("the messages are changed from outside")
+	}
+}
+
+func TestFormatRemovesLineBreaksInHeaders(t *testing.T) {
+	Init(&MemorySender{}, `no-reply@meow.com`)
+
+	b := string(format(Message{To: "susan@meow.com\r\nBcc: eve@evil.com", Subject: "Hi\nBcc: eve@evil.com", Body: "line 1\r\nline 2"}))
+	header := b[:strings.Index(b, "\r\n\r\n")]
+	if strings.Contains(header, "\r\nBcc:") || strings.Contains(header, "\nBcc:") {
+		t.Errorf("the header is injected:\n%s", header)
+	}
+	if strings.HasSuffix(b, "line 1\r\nline 2") == false {
+		t.Errorf("the body is changed:\n%s", b)
+	}
+}
@@ -2,16 +2,26 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 	"time"
 
+	"meow/lib/apikey"
+	"meow/lib/audit"
 	"meow/lib/auth"
+	"meow/lib/cookie"
+	"meow/lib/httputil"
 	"meow/lib/lock"
+	"meow/lib/mtls"
+	"meow/lib/revocation"
+	"meow/lib/txhook"
+	"meow/lib/validate"
 
 	"github.com/go-xorm/xorm"
 	"github.com/gorilla/mux"
@@ -33,6 +43,15 @@ func Init(database *xorm.Engine, client *redis.Client) {
 	redisClient = client
 }
 
+type claimsKey struct{}
+
+//the claims of the authenticated request, for the handler which needs more than the userId, e.g. the session
+//zero Claims is returned if the request is not authenticated by Auth or AuthAndTx
+func ClaimsOf(req *http.Request) auth.Claims {
+	claims, _ := req.Context().Value(claimsKey{}).(auth.Claims)
+	return claims
+}
+
 type HandlerWithTx func(r *http.Request, urlValues map[string]string, session *xorm.Session, userId string) (statusCode int, err error, output interface{})
 type Handler func(r *http.Request, urlValues map[string]string, db *xorm.Engine, userId string) (statusCode int, err error, output interface{})
 type PlainHandler func(res http.ResponseWriter, req *http.Request, urlValues map[string]string, db *xorm.Engine)
@@ -51,6 +70,33 @@ func Send(res http.ResponseWriter, statusCode int, data interface{}) {
 	}
 }
 
+//the output of the handler sent as a file download instead of JSON, e.g. the data export archive
+type File struct {
+	Path string
+	//the file name suggested to the browser
+	Name        string
+	ContentType string
+}
+
+func sendFile(res http.ResponseWriter, req *http.Request, file File) {
+	//the file may take longer than the WriteTimeout of the server for a slow client
+	if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+		log.Println("Failed to clear the write deadline:", err)
+	}
+	res.Header().Set("Content-Type", file.ContentType)
+	res.Header().Set("Content-Disposition", `attachment; filename="`+file.Name+`"`)
+	http.ServeFile(res, req, file.Path)
+}
+
+//send the error to the user, the field level validation errors are included if any
+func SendError(res http.ResponseWriter, statusCode int, err error) {
+	if fields, ok := err.(validate.FieldErrors); ok {
+		Send(res, statusCode, map[string]interface{}{"error": err.Error(), "fields": fields})
+	} else {
+		Send(res, statusCode, map[string]string{"error": err.Error()})
+	}
+}
+
 type cachedResponse struct {
 	StatusCode int
 	//since golang doesn't have same OOP concept as java
@@ -157,21 +203,130 @@ func DoubleDeleteIntercept(f DeleteHandler) HandlerWithTx {
 	}
 }
 
+//verify the jwt token or the API key in the request, and return the claims of the token
+//the token must have all the required scopes, otherwise http 403 is returned
+func authenticate(req *http.Request, scopes []string) (claims auth.Claims, statusCode int, err error) {
+	token, fromCookie := tokenFromRequest(req)
+
+	//the internal service doesn't send any token, it is identified by the client certificate
+	if token == `` && mtls.HasCertificate(req) {
+		claims, err := mtls.Authenticate(req)
+		if err != nil {
+			return auth.Claims{}, http.StatusUnauthorized, err
+		}
+		return authorize(claims, scopes)
+	}
+	if apikey.IsApiKey(token) && fromCookie == false {
+		claims, err := apikey.Authenticate(token)
+		if err == apikey.ErrInvalidKey {
+			return auth.Claims{}, http.StatusUnauthorized, err
+		} else if err != nil {
+			return auth.Claims{}, http.StatusInternalServerError, err
+		}
+		return authorize(claims, scopes)
+	}
+
+	claims, err = auth.Verify(token)
+	if err != nil {
+		return auth.Claims{}, http.StatusUnauthorized, err
+	}
+	//the CSRF token is bound to the session of the verified token, or to the token itself if it has no session
+	if fromCookie {
+		csrfSubject := claims.SessionId
+		if csrfSubject == `` {
+			csrfSubject = claims.TokenId
+		}
+		if cookie.CheckCsrf(req, csrfSubject) == false {
+			return auth.Claims{}, http.StatusForbidden, cookie.ErrCsrfToken
+		}
+	}
+
+	//reject the token revoked by "log out everywhere", or the token of a deleted user
+	if ok, err := revocation.IsTokenVersionValid(claims.UserId, claims.TokenVersion); err != nil {
+		return auth.Claims{}, http.StatusInternalServerError, err
+	} else if ok == false {
+		return auth.Claims{}, http.StatusUnauthorized, errors.New("The token is revoked.")
+	}
+
+	//every request made by the admin as the impersonated user is recorded, the request is rejected if it cannot be recorded
+	if claims.ActorId != `` {
+		if err := audit.Impersonation(claims.ActorId, claims.UserId, req.Method, req.URL.Path, httputil.ClientIp(req)); err != nil {
+			return auth.Claims{}, http.StatusInternalServerError, err
+		}
+	}
+
+	//reject the token denylisted individually
+	if claims.TokenId != `` {
+		if denied, err := revocation.IsTokenDenied(claims.TokenId); err != nil {
+			return auth.Claims{}, http.StatusInternalServerError, err
+		} else if denied {
+			return auth.Claims{}, http.StatusUnauthorized, errors.New("The token is revoked.")
+		}
+	}
+
+	//reject the token of the session ended by the user
+	if claims.SessionId != `` {
+		if ok, err := revocation.IsSessionValid(claims.SessionId); err != nil {
+			return auth.Claims{}, http.StatusInternalServerError, err
+		} else if ok == false {
+			return auth.Claims{}, http.StatusUnauthorized, errors.New("The session is revoked.")
+		}
+	}
+
+	return authorize(claims, scopes)
+}
+
+//the token in the Authorization header, or the token in the cookie for the browser
+func tokenFromRequest(req *http.Request) (token string, fromCookie bool) {
+	if header := req.Header.Get("Authorization"); header != `` {
+		return header, false
+	}
+	return cookie.Get(req, cookie.ACCESS_TOKEN), true
+}
+
+//the token or the API key must have all the required scopes
+func authorize(claims auth.Claims, scopes []string) (auth.Claims, int, error) {
+	for _, scope := range scopes {
+		if claims.HasScope(scope) == false {
+			return auth.Claims{}, http.StatusForbidden, errors.New("The token doesn't have the required scope: " + scope)
+		}
+	}
+
+	return claims, http.StatusOK, nil
+}
+
+//send a new token in the response header or the cookie, if the token is due for renewal by the renew policy
+//the old token is still valid until it expires, thus the request goes on even if the renewal fails
+func renewToken(res http.ResponseWriter, req *http.Request, claims auth.Claims) {
+	newToken, renewed, err := auth.Renew(claims)
+	if err != nil {
+		log.Println("Failed to renew the jwt token:", err)
+		return
+	}
+	if renewed == false {
+		return
+	}
+	if _, fromCookie := tokenFromRequest(req); fromCookie {
+		cookie.SetAccessToken(res, newToken)
+	} else {
+		res.Header().Set("Authorization", newToken)
+		//allow CORS
+		res.Header().Set("Access-Control-Expose-Headers", "Authorization")
+	}
+}
+
 // a middleware to handle user authorization
-func AuthAndTx(f HandlerWithTx) http.HandlerFunc {
+// the scopes are the scopes required by the handler
+func AuthAndTx(f HandlerWithTx, scopes ...string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userId, err := auth.Verify(req.Header.Get("Authorization"))
+		claims, statusCode, err := authenticate(req, scopes)
 		if err != nil {
-			Send(res, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			Send(res, statusCode, map[string]string{"error": err.Error()})
 			return
-		} else {
-			if newToken, err := auth.Sign(userId); err != nil {
-				Send(res, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-				return
-			} else {
-				res.Header().Add("Authorization", newToken) // update JWT Token
-			}
 		}
+		renewToken(res, req, claims)
+		req = req.WithContext(context.WithValue(req.Context(), claimsKey{}, claims))
+		userId := claims.UserId
 
 		//prepare a database session for the handler
 		session := db.NewSession()
@@ -180,6 +335,7 @@ func AuthAndTx(f HandlerWithTx) http.HandlerFunc {
 			return
 		}
 		defer session.Close()
+		defer txhook.Discard(session)
 
 		//everything seems fine, goto the business logic handler
 		if statusCode, err, output := f(req, mux.Vars(req), session, userId); err == nil {
@@ -187,36 +343,36 @@ func AuthAndTx(f HandlerWithTx) http.HandlerFunc {
 			if err := session.Commit(); err != nil {
 				Send(res, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			} else {
+				txhook.Committed(session)
 				Send(res, statusCode, output)
 			}
 		} else {
 			session.Rollback()
-			Send(res, statusCode, map[string]string{"error": err.Error()})
+			SendError(res, statusCode, err)
 		}
 	}
 }
 
 // a middleware to handle user authorization
-func Auth(f Handler) http.HandlerFunc {
+// the scopes are the scopes required by the handler
+func Auth(f Handler, scopes ...string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userId, err := auth.Verify(req.Header.Get("Authorization"))
+		claims, statusCode, err := authenticate(req, scopes)
 		if err != nil {
-			Send(res, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			Send(res, statusCode, map[string]string{"error": err.Error()})
 			return
-		} else {
-			if newToken, err := auth.Sign(userId); err != nil {
-				Send(res, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-				return
-			} else {
-				res.Header().Add("Authorization", newToken) // update JWT Token
-			}
 		}
+		renewToken(res, req, claims)
+		req = req.WithContext(context.WithValue(req.Context(), claimsKey{}, claims))
+		userId := claims.UserId
 
 		//everything seems fine, goto the business logic handler
-		if statusCode, err, output := f(req, mux.Vars(req), db, userId); err == nil {
-			Send(res, statusCode, output)
+		if statusCode, err, output := f(req, mux.Vars(req), db, userId); err != nil {
+			SendError(res, statusCode, err)
+		} else if file, ok := output.(File); ok {
+			sendFile(res, req, file)
 		} else {
-			Send(res, statusCode, map[string]string{"error": err.Error()})
+			Send(res, statusCode, output)
 		}
 	}
 }
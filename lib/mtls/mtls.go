@@ -0,0 +1,112 @@
+//the client certificate authentication for the internal services
+//the server verifies the client certificate against the CA bundle, and the subject of the certificate is mapped to a service principal
+//the service principal is a row in the users table with the service role, thus the handlers treat it in the same way as a user
+
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"meow/lib/auth"
+
+	"github.com/satori/go.uuid"
+)
+
+var (
+	ErrUnknownSubject = errors.New("The client certificate is not mapped to any service.")
+)
+
+//the identity of the service, passed to the handlers in place of the userId
+type Principal struct {
+	Id     string
+	Scopes []string
+}
+
+var (
+	//the common name of the certificate subject => the principal
+	principals map[string]Principal
+)
+
+func Init(p map[string]Principal) {
+	principals = p
+}
+
+//parse the mapping in the format "<common name>=<principal id>/<scope>,<scope>;<common name>=..."
+//e.g. "billing.internal=eeee1df4-9fae-4e32-98c1-88f850a00003/cat:read,cat:write"
+func ParsePrincipals(s string) (map[string]Principal, error) {
+	output := map[string]Principal{}
+	for _, entry := range strings.Split(s, `;`) {
+		entry = strings.TrimSpace(entry)
+		if entry == `` {
+			continue
+		}
+		subject := strings.SplitN(entry, `=`, 2)
+		if len(subject) != 2 {
+			return nil, errors.New("Improper service principal: " + entry)
+		}
+		principal := strings.SplitN(subject[1], `/`, 2)
+		if _, err := uuid.FromString(principal[0]); err != nil {
+			return nil, errors.New("Improper service principal id: " + entry)
+		}
+		p := Principal{Id: principal[0], Scopes: []string{}}
+		if len(principal) == 2 && principal[1] != `` {
+			p.Scopes = strings.Split(principal[1], `,`)
+		}
+		//a typo in the scope would silently deny the service
+		for _, scope := range p.Scopes {
+			if auth.IsValidScope(scope) == false {
+				return nil, errors.New("Unknown scope " + scope + " of service principal: " + entry)
+			}
+		}
+		output[strings.TrimSpace(subject[0])] = p
+	}
+	return output, nil
+}
+
+//the TLS config of the server. Empty caFile means the client certificate is not requested
+//the certificate is optional, thus the browsers and the mobile clients can still connect without it
+func ServerTlsConfig(caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == `` {
+		return config, nil
+	}
+
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if pool.AppendCertsFromPEM(b) == false {
+		return nil, errors.New(caFile + ": no certificate is found in the CA bundle")
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
+
+//true if the request has a client certificate verified against the CA bundle
+func HasCertificate(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+//return the claims of the service principal of the verified client certificate
+func Authenticate(r *http.Request) (auth.Claims, error) {
+	if HasCertificate(r) == false {
+		return auth.Claims{}, errors.New("The client certificate is missing.")
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	p, ok := principals[subject]
+	if !ok {
+		return auth.Claims{}, ErrUnknownSubject
+	}
+	return auth.Claims{
+		UserId: p.Id,
+		Role:   auth.ROLE_SERVICE,
+		Scopes: p.Scopes,
+	}, nil
+}
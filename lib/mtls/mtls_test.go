@@ -0,0 +1,170 @@
+package mtls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type keyPair struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+//generate a certificate signed by the parent, or a self-signed CA if parent is nil
+func generate(t *testing.T, commonName string, parent *keyPair) *keyPair {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.ParseIP(`127.0.0.1`)},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &keyPair{cert: cert, key: key}
+}
+
+func tlsCertificate(p *keyPair) tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{p.cert.Raw}, PrivateKey: p.key, Leaf: p.cert}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ca := generate(t, `Meow Test CA`, nil)
+	server := generate(t, `localhost`, ca)
+	billing := generate(t, `billing.internal`, ca)
+	unknown := generate(t, `unknown.internal`, ca)
+	foreign := generate(t, `billing.internal`, generate(t, `Foreign CA`, nil))
+
+	tmp, err := ioutil.TempDir(``, `meow-mtls`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	caFile := filepath.Join(tmp, `ca.crt`)
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: ca.cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	principals, err := ParsePrincipals(`billing.internal=eeee1df4-9fae-4e32-98c1-88f850a00003/cat:read`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Init(principals)
+	tlsConfig, err := ServerTlsConfig(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{tlsCertificate(server)}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if HasCertificate(r) == false {
+			fmt.Fprint(w, `no certificate`)
+			return
+		}
+		if claims, err := Authenticate(r); err != nil {
+			fmt.Fprint(w, err.Error())
+		} else {
+			fmt.Fprint(w, claims.UserId+` `+claims.Role+` `+strings.Join(claims.Scopes, ` `))
+		}
+	}))
+	ts.TLS = tlsConfig
+	//the handshake of the foreign certificate is logged by the server
+	ts.Config.ErrorLog = log.New(ioutil.Discard, ``, 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cases := []struct {
+		name   string
+		client *keyPair
+		expect string
+		failed bool
+	}{
+		{`no client certificate`, nil, `no certificate`, false},
+		{`known service`, billing, `eeee1df4-9fae-4e32-98c1-88f850a00003 service cat:read`, false},
+		{`unknown subject`, unknown, ErrUnknownSubject.Error(), false},
+		{`certificate of a foreign CA`, foreign, ``, true},
+	}
+	for _, c := range cases {
+		clientConfig := &tls.Config{RootCAs: roots, ServerName: `localhost`}
+		if c.client != nil {
+			//always send the certificate, even if it is not issued by the CA requested by the server
+			certificate := tlsCertificate(c.client)
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &certificate, nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		body, err := get(client, ts.URL)
+		if c.failed {
+			if err == nil {
+				t.Errorf("%s: expected the handshake to fail, got %q", c.name, body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if body != c.expect {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expect, body)
+		}
+	}
+}
+
+func TestParsePrincipalsRejectsUnknownScope(t *testing.T) {
+	if _, err := ParsePrincipals(`billing.internal=eeee1df4-9fae-4e32-98c1-88f850a00003/cat:read,cat:reed`); err == nil {
+		t.Error("the unknown scope is accepted")
+	}
+	if _, err := ParsePrincipals(`billing.internal=eeee1df4-9fae-4e32-98c1-88f850a00003/cat:read,cat:write`); err != nil {
+		t.Error(err)
+	}
+}
+
+func get(client *http.Client, url string) (string, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return ``, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	return string(b), err
+}
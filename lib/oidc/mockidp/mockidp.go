@@ -0,0 +1,200 @@
+//a mock OpenID Connect identity provider for the development and testing of the oidc login
+//it approves every login request immediately, as the user given by the login_hint parameter or the default email
+//it is served by tools/mockidp for the manual test, and by httptest in the tests of lib/oidc
+
+package mockidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"meow/lib/jose"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const kid = `mock-key`
+
+type Provider struct {
+	//the issuer must be the base url the provider is served at
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	//the email of the user, if login_hint is not given
+	DefaultEmail string
+
+	key *rsa.PrivateKey
+
+	//the issued authorization codes, each code can be used once only
+	codeLock sync.Mutex
+	codes    map[string]authRequest
+}
+
+type authRequest struct {
+	RedirectUri   string
+	Nonce         string
+	CodeChallenge string
+	Email         string
+}
+
+func New(issuer, clientId, clientSecret, defaultEmail string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{
+		Issuer:       issuer,
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		DefaultEmail: defaultEmail,
+		key:          key,
+		codes:        map[string]authRequest{},
+	}, nil
+}
+
+//the endpoints of the provider, relative to the issuer
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	return mux
+}
+
+func sendJson(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	sendJson(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != p.ClientId || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		sendJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	redirectUri, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectUri.IsAbs() == false {
+		sendJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	email := q.Get("login_hint")
+	if email == `` {
+		email = p.DefaultEmail
+	}
+	code, err := randomString()
+	if err != nil {
+		sendJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	p.codeLock.Lock()
+	p.codes[code] = authRequest{RedirectUri: q.Get("redirect_uri"), Nonce: q.Get("nonce"), CodeChallenge: q.Get("code_challenge"), Email: email}
+	p.codeLock.Unlock()
+
+	v := redirectUri.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	redirectUri.RawQuery = v.Encode()
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if id != p.ClientId || secret != p.ClientSecret {
+		sendJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.codeLock.Lock()
+	req, found := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.codeLock.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if found == false || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != req.RedirectUri ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != req.CodeChallenge {
+		sendJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	t := jwt.New(jwt.SigningMethodRS256)
+	t.Header["kid"] = kid
+	t.Claims["iss"] = p.Issuer
+	t.Claims["sub"] = "mock-" + req.Email
+	t.Claims["aud"] = p.ClientId
+	t.Claims["iat"] = time.Now().Unix()
+	t.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	t.Claims["nonce"] = req.Nonce
+	t.Claims["email"] = req.Email
+	t.Claims["email_verified"] = true
+	t.Claims["given_name"] = "Mock"
+	t.Claims["family_name"] = "User"
+	idToken, err := t.SignedString(p.key)
+	if err != nil {
+		sendJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	accessToken, err := randomString()
+	if err != nil {
+		sendJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	sendJson(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	sendJson(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   jose.EncodeBigInt(p.key.PublicKey.N),
+			"e":   jose.EncodeBigInt(big.NewInt(int64(p.key.PublicKey.E))),
+		}},
+	})
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return ``, err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
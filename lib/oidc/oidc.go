@@ -0,0 +1,353 @@
+//login with the external OpenID Connect identity provider, with authorization code flow and PKCE (RFC 7636)
+//this module acts as the relying party, the provider is located by the discovery document of the issuer
+
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"meow/lib/jose"
+	"meow/lib/randtoken"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	redis "gopkg.in/redis.v3"
+)
+
+const (
+	//the period for the user to login at the identity provider
+	STATE_LIFETIME = 10 * time.Minute
+	//the period for the client to redeem the handover code after the callback
+	HANDOVER_LIFETIME = time.Minute
+	//the minimum interval between reloading the jwks, thus a token with unknown kid cannot flood the provider
+	JWKS_RELOAD_INTERVAL = time.Minute
+)
+
+type Config struct {
+	//empty string means the oidc login is disabled
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	//the callback url registered at the provider
+	RedirectUrl string
+}
+
+//the identity of the user asserted by the id token
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+var (
+	ErrInvalidState    = errors.New("The login request is invalid or expired, please login again.")
+	ErrInvalidHandover = errors.New("The login is not found or already used, please login again.")
+)
+
+var (
+	conf        Config
+	redisClient *redis.Client
+	httpClient  = &http.Client{Timeout: 10 * time.Second}
+
+	//the provider metadata and keys, loaded lazily thus the server can start even if the provider is down
+	providerLock   sync.Mutex
+	metadata       *providerMetadata
+	jwks           map[string]interface{}
+	jwksReloadTime time.Time
+)
+
+//the redis is used for storing the state of the login requests
+func Init(c Config, client *redis.Client) {
+	conf = c
+	redisClient = client
+}
+
+func Enabled() bool {
+	return conf.Issuer != ``
+}
+
+//the discovery document, see OpenID Connect Discovery 1.0
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+//the state of a login request, stored in redis until the callback
+type loginState struct {
+	Nonce        string
+	CodeVerifier string
+}
+
+func stateKey(state string) string {
+	return `oidc-state-` + state
+}
+
+//start the login, return the url of the provider for redirecting the browser
+//the state should be kept in the browser starting the login, and compared in the callback, thus the callback cannot be forged for another browser
+func AuthCodeUrl() (redirectUrl string, state string, err error) {
+	m, err := getMetadata()
+	if err != nil {
+		return ``, ``, err
+	}
+
+	s := loginState{}
+	for _, p := range []*string{&state, &s.Nonce, &s.CodeVerifier} {
+		if *p, err = randtoken.New(); err != nil {
+			return ``, ``, err
+		}
+	}
+	b, _ := json.Marshal(s)
+	if err := redisClient.Set(stateKey(state), b, STATE_LIFETIME).Err(); err != nil {
+		return ``, ``, err
+	}
+	return authCodeUrl(m, state, s), state, nil
+}
+
+//the authorization request with the PKCE challenge of the code verifier, and the nonce expected in the id token
+func authCodeUrl(m *providerMetadata, state string, s loginState) string {
+	challenge := sha256.Sum256([]byte(s.CodeVerifier))
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", conf.ClientId)
+	v.Set("redirect_uri", conf.RedirectUrl)
+	v.Set("scope", "openid email profile")
+	v.Set("state", state)
+	v.Set("nonce", s.Nonce)
+	v.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	v.Set("code_challenge_method", "S256")
+
+	separator := `?`
+	if strings.Contains(m.AuthorizationEndpoint, `?`) {
+		separator = `&`
+	}
+	return m.AuthorizationEndpoint + separator + v.Encode()
+}
+
+func handoverKey(code string) string {
+	return `oidc-handover-` + randtoken.Digest(code)
+}
+
+//the callback is a redirect of the browser, which cannot pass the tokens to the client
+//thus the callback hands over the login by a one-time code, and the client exchanges it for the tokens
+func NewHandover(userId string) (string, error) {
+	code, err := randtoken.New()
+	if err != nil {
+		return ``, err
+	}
+	if err := redisClient.Set(handoverKey(code), userId, HANDOVER_LIFETIME).Err(); err != nil {
+		return ``, err
+	}
+	return code, nil
+}
+
+//return the user logged in by the callback. The code is single-use
+func RedeemHandover(code string) (userId string, err error) {
+	if code == `` {
+		return ``, ErrInvalidHandover
+	}
+	userId, err = redisClient.Get(handoverKey(code)).Result()
+	if err == redis.Nil {
+		return ``, ErrInvalidHandover
+	}
+	if err != nil {
+		return ``, err
+	}
+	//only the request deleting the code can use it, even for concurrent requests
+	if deleted, err := redisClient.Del(handoverKey(code)).Result(); err != nil {
+		return ``, err
+	} else if deleted == 0 {
+		return ``, ErrInvalidHandover
+	}
+	return userId, nil
+}
+
+//complete the login with the state and code in the callback, return the identity in the verified id token
+func Exchange(state, code string) (*Identity, error) {
+	//the state is single-use
+	b, err := redisClient.Get(stateKey(state)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := redisClient.Del(stateKey(state)).Err(); err != nil {
+		return nil, err
+	}
+	s := loginState{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return exchange(s, code)
+}
+
+//redeem the code with the code verifier of the login request, and verify the nonce in the id token
+func exchange(s loginState, code string) (*Identity, error) {
+	m, err := getMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", conf.RedirectUrl)
+	form.Set("code_verifier", s.CodeVerifier)
+	req, err := http.NewRequest("POST", m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	//client_secret_basic, the id and secret are form-urlencoded (RFC 6749 section 2.3.1)
+	req.SetBasicAuth(url.QueryEscape(conf.ClientId), url.QueryEscape(conf.ClientSecret))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var output struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&output); err != nil {
+		return nil, err
+	}
+	if output.Error != `` {
+		return nil, errors.New("The identity provider rejected the login: " + output.Error + " " + output.ErrorDescription)
+	}
+	if res.StatusCode != http.StatusOK || output.IdToken == `` {
+		return nil, errors.New("The identity provider returned no id token")
+	}
+
+	return verifyIdToken(output.IdToken, m.Issuer, s.Nonce)
+}
+
+func verifyIdToken(idToken, issuer, nonce string) (*Identity, error) {
+	//the exp is verified by the jwt library
+	token, err := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("Unexpected signing method")
+		}
+		kid, _ := t.Header["kid"].(string)
+		return getKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.Valid == false {
+		return nil, errors.New("Wrong id token")
+	}
+
+	if iss, _ := token.Claims["iss"].(string); iss != issuer {
+		return nil, errors.New("The id token is issued by other issuer")
+	}
+	if jose.HasAudience(token.Claims["aud"], conf.ClientId) == false {
+		return nil, errors.New("The id token is issued for other client")
+	}
+	if n, _ := token.Claims["nonce"].(string); n != nonce {
+		return nil, errors.New("The nonce of the id token doesn't match")
+	}
+
+	identity := Identity{Issuer: issuer}
+	identity.Subject, _ = token.Claims["sub"].(string)
+	identity.Email, _ = token.Claims["email"].(string)
+	identity.EmailVerified, _ = token.Claims["email_verified"].(bool)
+	identity.GivenName, _ = token.Claims["given_name"].(string)
+	identity.FamilyName, _ = token.Claims["family_name"].(string)
+	if identity.Subject == `` {
+		return nil, errors.New("The id token has no subject")
+	}
+	return &identity, nil
+}
+
+func getMetadata() (*providerMetadata, error) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+
+	if metadata != nil {
+		return metadata, nil
+	}
+
+	m := providerMetadata{}
+	if err := getJson(strings.TrimSuffix(conf.Issuer, `/`)+`/.well-known/openid-configuration`, &m); err != nil {
+		return nil, err
+	}
+	if m.Issuer != conf.Issuer {
+		return nil, errors.New("The issuer in the discovery document doesn't match: " + m.Issuer)
+	}
+	metadata = &m
+	return metadata, nil
+}
+
+//find the public key of the provider by kid, the keys are reloaded if the kid is unknown, i.e. the provider rotated the key
+func getKey(kid string) (interface{}, error) {
+	m, err := getMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	providerLock.Lock()
+	defer providerLock.Unlock()
+
+	if key, ok := jwks[kid]; ok {
+		return key, nil
+	}
+	if time.Since(jwksReloadTime) < JWKS_RELOAD_INTERVAL {
+		return nil, errors.New("Unknown key of the identity provider")
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	jwksReloadTime = time.Now()
+	if err := getJson(m.JwksUri, &set); err != nil {
+		return nil, err
+	}
+
+	jwks = map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Kty != `RSA` {
+			continue
+		}
+		if key, err := jose.RsaPublicKey(k.N, k.E); err == nil {
+			jwks[k.Kid] = key
+		}
+	}
+
+	if key, ok := jwks[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("Unknown key of the identity provider")
+}
+
+func getJson(url string, out interface{}) error {
+	res, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("Failed to load " + url + ": " + res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"meow/lib/oidc/mockidp"
+)
+
+const testRedirectUrl = `http://localhost:8080/v1/auth/oidc/callback`
+
+//serve the mock provider, the state in redis is bypassed by calling authCodeUrl and exchange directly
+func startMockProvider(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	provider, err := mockidp.New(ts.URL, `meow`, `meow_secret`, `mock.user@abc.com`)
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	mux.Handle("/", provider.Handler())
+
+	Init(Config{Issuer: ts.URL, ClientId: `meow`, ClientSecret: `meow_secret`, RedirectUrl: testRedirectUrl}, nil)
+	providerLock.Lock()
+	metadata, jwks = nil, nil
+	providerLock.Unlock()
+	return ts
+}
+
+//visit the authorization endpoint as the browser, and return the query of the callback
+func authorize(t *testing.T, state string, s loginState) url.Values {
+	m, err := getMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authCodeUrl(m, state, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("expected the redirect to the callback, got %d", res.StatusCode)
+	}
+	callback, err := res.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Scheme+`://`+callback.Host+callback.Path != testRedirectUrl {
+		t.Fatalf("unexpected callback %s", callback)
+	}
+	return callback.Query()
+}
+
+func TestExchangeWithMockProvider(t *testing.T) {
+	ts := startMockProvider(t)
+	defer ts.Close()
+
+	s := loginState{Nonce: `the-nonce`, CodeVerifier: `the-code-verifier-which-is-long-enough-for-pkce`}
+	query := authorize(t, `the-state`, s)
+	if query.Get("state") != `the-state` {
+		t.Fatalf("the state is not returned, got %q", query.Get("state"))
+	}
+
+	identity, err := exchange(s, query.Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Issuer != ts.URL || identity.Subject != `mock-mock.user@abc.com` || identity.Email != `mock.user@abc.com` || identity.EmailVerified == false {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	//the code is single-use
+	if _, err := exchange(s, query.Get("code")); err == nil {
+		t.Error("the code is exchanged twice")
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	ts := startMockProvider(t)
+	defer ts.Close()
+
+	s := loginState{Nonce: `the-nonce`, CodeVerifier: `the-code-verifier-which-is-long-enough-for-pkce`}
+	query := authorize(t, `the-state`, s)
+
+	//e.g. the code is intercepted and redeemed by another client
+	s.CodeVerifier = `another-code-verifier-which-is-long-enough-for-pkce`
+	if _, err := exchange(s, query.Get("code")); err == nil {
+		t.Error("the code is exchanged with a wrong code verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	ts := startMockProvider(t)
+	defer ts.Close()
+
+	s := loginState{Nonce: `the-nonce`, CodeVerifier: `the-code-verifier-which-is-long-enough-for-pkce`}
+	query := authorize(t, `the-state`, s)
+
+	//e.g. the id token is replayed from another login request
+	s.Nonce = `another-nonce`
+	if _, err := exchange(s, query.Get("code")); err == nil {
+		t.Error("the id token of another nonce is accepted")
+	}
+}
@@ -0,0 +1,149 @@
+//the password hashing, the digests are self-describing thus the algorithm and the parameters can be changed anytime
+//the digests made by the outdated algorithm or parameters are still verified, and the caller should rehash them
+
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ALGORITHM_BCRYPT   = `bcrypt`
+	ALGORITHM_ARGON2ID = `argon2id`
+)
+
+type Hasher interface {
+	Hash(password string) (digest string, err error)
+	//true if the digest is made by the algorithm of this hasher
+	Accepts(digest string) bool
+	Verify(password string, digest string) (bool, error)
+	//true if the digest is made with the same parameters as this hasher, otherwise it should be rehashed
+	IsCurrent(digest string) bool
+}
+
+var (
+	current Hasher
+	hashers []Hasher
+)
+
+//the current hasher hashes the new passwords, the digests made by the other hashers are still verified
+func Init(c Hasher, others ...Hasher) {
+	current = c
+	hashers = append([]Hasher{c}, others...)
+}
+
+func Hash(password string) (string, error) {
+	return current.Hash(password)
+}
+
+//verify the password against the digest. The digest of unknown format, e.g. empty digest, never matches
+//rehash is true if the password matches, and the digest should be replaced by a digest of the current hasher
+func Verify(password string, digest string) (ok bool, rehash bool, err error) {
+	for _, h := range hashers {
+		if h.Accepts(digest) == false {
+			continue
+		}
+		if ok, err := h.Verify(password, digest); err != nil || ok == false {
+			return false, false, err
+		}
+		return true, current.Accepts(digest) == false || current.IsCurrent(digest) == false, nil
+	}
+	return false, false, nil
+}
+
+//the digest is in the modular crypt format, e.g. $2a$10$...
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	digest, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(digest), err
+}
+
+func (h BcryptHasher) Accepts(digest string) bool {
+	return strings.HasPrefix(digest, `$2a$`) || strings.HasPrefix(digest, `$2b$`) || strings.HasPrefix(digest, `$2y$`)
+}
+
+func (h BcryptHasher) Verify(password string, digest string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(digest), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) IsCurrent(digest string) bool {
+	cost, err := bcrypt.Cost([]byte(digest))
+	return err == nil && cost == h.Cost
+}
+
+//the digest is in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idHasher struct {
+	Time uint32
+	//measured in KiB
+	Memory  uint32
+	Threads uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return ``, err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Accepts(digest string) bool {
+	return strings.HasPrefix(digest, `$argon2id$`)
+}
+
+func (h Argon2idHasher) Verify(password string, digest string) (bool, error) {
+	params, salt, key, err := parseArgon2id(digest)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h Argon2idHasher) IsCurrent(digest string) bool {
+	params, _, _, err := parseArgon2id(digest)
+	return err == nil && params == h
+}
+
+func parseArgon2id(digest string) (params Argon2idHasher, salt []byte, key []byte, err error) {
+	parts := strings.Split(digest, `$`)
+	if len(parts) != 6 || parts[1] != ALGORITHM_ARGON2ID {
+		return params, nil, nil, errors.New("Improper argon2id digest")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("Unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, errors.New("Improper argon2id digest")
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,74 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//the requirements of the new password, applied when the password is created, changed or reset
+type Policy struct {
+	MinLength int
+	//from 0 to 4, see Score
+	MinScore int
+	//the directory of the breached password list in the format of the HIBP range API
+	//each file is named by the first 5 hex characters of the SHA-1 of the password, and each line is "<the other 35 hex characters>:<count>"
+	//empty string means the check is disabled
+	BreachedDir string
+}
+
+var (
+	policy Policy
+)
+
+func SetPolicy(p Policy) {
+	policy = p
+}
+
+//check the new password against the policy, and return the reasons of rejection
+//the user inputs, e.g. the email and the names, should not be part of the password
+func Check(password string, userInputs ...string) (problems []string, err error) {
+	if len([]rune(password)) < policy.MinLength {
+		problems = append(problems, "The password must have at least "+strconv.Itoa(policy.MinLength)+" characters.")
+	}
+	if Score(password, userInputs...) < policy.MinScore {
+		problems = append(problems, "The password is too easy to guess.")
+	}
+	if breached, err := IsBreached(password); err != nil {
+		return nil, err
+	} else if breached {
+		problems = append(problems, "The password has appeared in a data breach, please choose another one.")
+	}
+	return problems, nil
+}
+
+//look up the SHA-1 of the password in the breached password list, only the file of its 5 characters prefix is read
+func IsBreached(password string) (bool, error) {
+	if policy.BreachedDir == `` {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.Open(filepath.Join(policy.BreachedDir, digest[:5]))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		suffix := strings.SplitN(strings.TrimSpace(scanner.Text()), `:`, 2)[0]
+		if strings.EqualFold(suffix, digest[5:]) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,186 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+//the common passwords and words, matched case-insensitively after undoing the l33t substitutions
+//the order is the rank, the top entries are guessed first
+var commonWords = []string{
+	`password`, `123456`, `qwerty`, `letmein`, `welcome`, `admin`, `iloveyou`, `monkey`, `dragon`, `football`,
+	`baseball`, `sunshine`, `princess`, `master`, `shadow`, `superman`, `trustno1`, `login`, `starwars`, `whatever`,
+	`freedom`, `secret`, `hello`, `charlie`, `summer`, `winter`, `spring`, `autumn`, `love`, `meow`, `kitty`, `cat`,
+}
+
+//the keyboard rows and the alphabet, three or more adjacent keys are matched as a sequence
+var sequences = []string{
+	`abcdefghijklmnopqrstuvwxyz`, `0123456789`, `qwertyuiop`, `asdfghjkl`, `zxcvbnm`, `1qaz2wsx3edc`,
+}
+
+var l33t = strings.NewReplacer(`4`, `a`, `@`, `a`, `8`, `b`, `3`, `e`, `1`, `i`, `!`, `i`, `0`, `o`, `5`, `s`, `$`, `s`, `7`, `t`)
+
+//estimate the strength in the same scale as zxcvbn, from 0 (too guessable) to 4 (very unguessable)
+//the password is split greedily into the dictionary words, repeats, sequences and the random characters,
+//and the number of guesses of each part is multiplied. The user inputs, e.g. the email and the names, are in the dictionary too
+func Score(password string, userInputs ...string) int {
+	guesses := estimateGuesses(password, userInputs)
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	}
+	return 4
+}
+
+func estimateGuesses(password string, userInputs []string) float64 {
+	words := []string{}
+	for _, input := range userInputs {
+		for _, w := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if len(w) >= 3 {
+				words = append(words, w)
+			}
+		}
+	}
+	words = append(words, commonWords...)
+
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	unl33t := []rune(l33t.Replace(strings.ToLower(password)))
+
+	//the characters not matching any pattern are guessed by brute force, by the character classes they use
+	guesses := 1.0
+	random := []rune{}
+	for i := 0; i < len(runes); {
+		length, g := 0, 0.0
+		if n, rank := matchWord(lower, unl33t, i, words); n > 0 {
+			length, g = n, float64(rank+1)*10
+		} else if n := matchYear(lower, i); n > 0 {
+			length, g = n, 120
+		} else if n := matchRepeat(lower, i); n > 0 {
+			length, g = n, bruteForceCardinality(runes[i:i+1])*float64(n)
+		} else if n := matchSequence(lower, i); n > 0 {
+			length, g = n, 26*float64(n)
+		}
+
+		if length == 0 {
+			random = append(random, runes[i])
+			i++
+			continue
+		}
+		guesses *= bruteForce(random) * g
+		random = random[:0]
+		i += length
+	}
+	guesses *= bruteForce(random)
+	return math.Max(guesses, 1)
+}
+
+func bruteForce(runes []rune) float64 {
+	if len(runes) == 0 {
+		return 1
+	}
+	return math.Pow(bruteForceCardinality(runes), float64(len(runes)))
+}
+
+//a recent year, e.g. the birth year
+func matchYear(lower []rune, i int) int {
+	if i+4 > len(lower) {
+		return 0
+	}
+	s := string(lower[i : i+4])
+	if (strings.HasPrefix(s, `19`) || strings.HasPrefix(s, `20`)) && strings.Trim(s, `0123456789`) == `` {
+		return 4
+	}
+	return 0
+}
+
+//the longest dictionary word at position i, and its rank
+//the l33t replacement maps one character to one character, thus the positions are the same
+func matchWord(lower, unl33t []rune, i int, words []string) (length int, rank int) {
+	for r, w := range words {
+		n := len([]rune(w))
+		if n <= length || i+n > len(lower) {
+			continue
+		}
+		if string(lower[i:i+n]) == w || string(unl33t[i:i+n]) == w {
+			length, rank = n, r
+		}
+	}
+	return length, rank
+}
+
+//the same character repeated three times or more
+func matchRepeat(lower []rune, i int) int {
+	n := 1
+	for i+n < len(lower) && lower[i+n] == lower[i] {
+		n++
+	}
+	if n < 3 {
+		return 0
+	}
+	return n
+}
+
+//three or more adjacent characters in a sequence, forward or backward
+func matchSequence(lower []rune, i int) int {
+	best := 0
+	for _, seq := range sequences {
+		for _, s := range []string{seq, reverse(seq)} {
+			n := 0
+			for i+n < len(lower) && n < len(s) {
+				if strings.Contains(s, string(lower[i:i+n+1])) == false {
+					break
+				}
+				n++
+			}
+			if n >= 3 && n > best {
+				best = n
+			}
+		}
+	}
+	return best
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+//the number of possible characters at each position, by the character classes used in the password
+func bruteForceCardinality(runes []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	cardinality := 0.0
+	for _, c := range []struct {
+		used bool
+		size float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			cardinality += c.size
+		}
+	}
+	return math.Max(cardinality, 10)
+}
@@ -0,0 +1,103 @@
+//the object level privilege checking
+//each resource(table) registers its rule, and the handlers get the sql condition limiting the rows the user can access
+
+package policy
+
+import (
+	"errors"
+
+	"meow/lib/auth"
+
+	"github.com/go-xorm/xorm"
+)
+
+type Action int
+
+const (
+	READ Action = iota
+	UPDATE
+	DELETE
+)
+
+//the access rule of a resource. The primary key of the table must be "id"
+type Rule struct {
+	//the column storing the userId of the owner, the owner can perform all actions
+	OwnerColumn string
+
+	//the table granting the access to other users, it has the column ShareColumn(referencing the resource) and user_id
+	//empty string means the resource cannot be shared
+	ShareTable  string
+	ShareColumn string
+	//the actions allowed to the users who are shared with
+	SharedActions []Action
+
+	//if true, the admin can perform all actions on all rows
+	AdminOverride bool
+	//the actions the internal services can perform on all rows, the service is still limited by its scopes
+	ServiceActions []Action
+}
+
+var (
+	db    *xorm.Engine
+	rules = map[string]Rule{}
+)
+
+func Init(database *xorm.Engine) {
+	db = database
+}
+
+//it should be called in the init() of the handler of the resource
+func Register(tableName string, rule Rule) {
+	rules[tableName] = rule
+}
+
+//return the sql condition limiting the rows the user can perform the action on
+func Condition(tableName, userId string, action Action) (condition string, args []interface{}, err error) {
+	rule, ok := rules[tableName]
+	if ok == false {
+		//fail close, the resource without rule is not accessible
+		return ``, nil, errors.New("No policy is registered for " + tableName)
+	}
+
+	if rule.AdminOverride || containAction(rule.ServiceActions, action) {
+		role, err := roleOf(userId)
+		if err != nil {
+			return ``, nil, err
+		}
+		if rule.AdminOverride && role == auth.ROLE_ADMIN {
+			return `1 = 1`, nil, nil
+		}
+		if role == auth.ROLE_SERVICE && containAction(rule.ServiceActions, action) {
+			return `1 = 1`, nil, nil
+		}
+	}
+
+	condition = rule.OwnerColumn + ` = ?`
+	args = []interface{}{userId}
+	if rule.ShareTable != `` && containAction(rule.SharedActions, action) {
+		condition = `(` + condition + ` or id in (select ` + rule.ShareColumn + ` from ` + rule.ShareTable + ` where user_id = ?))`
+		args = append(args, userId)
+	}
+	return condition, args, nil
+}
+
+func containAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+//the role is read from database instead of the jwt token, thus the revoked admin right takes effect immediately
+//empty string is returned if the user is not found
+func roleOf(userId string) (string, error) {
+	user := struct {
+		Role string
+	}{}
+	if _, err := db.Table("users").Where("id = ?", userId).Cols("role").Get(&user); err != nil {
+		return ``, err
+	}
+	return user.Role, nil
+}
@@ -0,0 +1,29 @@
+//opaque random tokens, e.g. refresh token, which are meaningless to the client
+
+package randtoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+//the token has 256 bits of entropy
+const tokenLength = 32
+
+//generate a random token, encoded in base64url
+func New() (string, error) {
+	b := make([]byte, tokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return ``, err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//the token should be stored in form of the digest only, thus leaking the storage doesn't leak the usable token.
+//as the token is random with high entropy, a fast hash is enough
+func Digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,193 @@
+//the opaque refresh tokens, which are used to obtain new short-lived jwt access token
+//each login starts a token family, every refresh rotates the token within the family.
+//the family id is the id of the login session, thus revoking the session revokes its refresh tokens
+//if a rotated token is presented again, the token is probably stolen, and the whole family is revoked
+
+package refresh
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"meow/lib/randtoken"
+
+	redis "gopkg.in/redis.v3"
+)
+
+var (
+	redisClient   *redis.Client
+	tokenLifeTime time.Duration
+)
+
+var (
+	ErrInvalidToken = errors.New("The refresh token is invalid or expired.")
+	ErrTokenReused  = errors.New("The refresh token is already used. The session is revoked.")
+)
+
+func Init(client *redis.Client, lifeTime time.Duration) {
+	redisClient = client
+	tokenLifeTime = lifeTime
+}
+
+//the token version of the family started before the version is recorded, it is not checked
+const UNKNOWN_TOKEN_VERSION = -1
+
+//the value stored in redis for each refresh token, the key is the digest of the token
+type record struct {
+	UserId   string
+	FamilyId string
+	//the token version of the user when the family started, nil for the family started before it is recorded
+	TokenVersion *int `json:",omitempty"`
+}
+
+func tokenKey(digest string) string {
+	return `refresh-token-` + digest
+}
+
+//exists only if the token is already rotated
+func usedKey(digest string) string {
+	return `refresh-used-` + digest
+}
+
+//exists only if the family is not yet revoked
+func familyKey(familyId string) string {
+	return `refresh-family-` + familyId
+}
+
+//the set of the token families of the user
+func userKey(userId string) string {
+	return `refresh-user-` + userId
+}
+
+//start a new token family for the login session, and return its first refresh token
+//the family is rejected once the token version of the user is increased
+func Issue(userId string, familyId string, tokenVersion int) (token string, err error) {
+	if err := redisClient.Set(familyKey(familyId), userId, tokenLifeTime).Err(); err != nil {
+		return ``, err
+	}
+	if err := redisClient.SAdd(userKey(userId), familyId).Err(); err != nil {
+		return ``, err
+	}
+	//the set outlives all the families inside, as each family expires within the token lifetime
+	if err := redisClient.Expire(userKey(userId), tokenLifeTime).Err(); err != nil {
+		return ``, err
+	}
+	return issue(record{UserId: userId, FamilyId: familyId, TokenVersion: &tokenVersion})
+}
+
+func issue(r record) (string, error) {
+	token, err := randtoken.New()
+	if err != nil {
+		return ``, err
+	}
+	b, _ := json.Marshal(r)
+	if err := redisClient.Set(tokenKey(randtoken.Digest(token)), b, tokenLifeTime).Err(); err != nil {
+		return ``, err
+	}
+	return token, nil
+}
+
+func find(token string) (*record, error) {
+	b, err := redisClient.Get(tokenKey(randtoken.Digest(token))).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := record{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+//exchange the refresh token for a new one in the same family. Each refresh token can be used once only
+//the caller should compare the returned token version with the current one of the user, unless it is UNKNOWN_TOKEN_VERSION
+func Rotate(token string) (userId string, familyId string, tokenVersion int, newToken string, err error) {
+	r, err := find(token)
+	if err != nil {
+		return ``, ``, 0, ``, err
+	}
+
+	//the rotated token is kept until it expires, thus the reuse can be detected
+	//SETNX ensures only one request can rotate the token, even for concurrent requests
+	digest := randtoken.Digest(token)
+	if ok, err := redisClient.SetNX(usedKey(digest), ``, tokenLifeTime).Result(); err != nil {
+		return ``, ``, 0, ``, err
+	} else if ok == false {
+		if err := redisClient.Del(familyKey(r.FamilyId)).Err(); err != nil {
+			return ``, ``, 0, ``, err
+		}
+		return ``, ``, 0, ``, ErrTokenReused
+	}
+
+	if exists, err := redisClient.Exists(familyKey(r.FamilyId)).Result(); err != nil {
+		return ``, ``, 0, ``, err
+	} else if exists == false {
+		return ``, ``, 0, ``, ErrInvalidToken
+	}
+
+	//sliding expiry of the family, it expires if the client doesn't refresh within the token lifetime
+	//the set of the user is extended too, otherwise RevokeAll cannot find the family after the set expires
+	if err := redisClient.Expire(familyKey(r.FamilyId), tokenLifeTime).Err(); err != nil {
+		return ``, ``, 0, ``, err
+	}
+	if err := redisClient.Expire(userKey(r.UserId), tokenLifeTime).Err(); err != nil {
+		return ``, ``, 0, ``, err
+	}
+	if newToken, err = issue(*r); err != nil {
+		return ``, ``, 0, ``, err
+	}
+
+	tokenVersion = UNKNOWN_TOKEN_VERSION
+	if r.TokenVersion != nil {
+		tokenVersion = *r.TokenVersion
+	}
+	return r.UserId, r.FamilyId, tokenVersion, newToken, nil
+}
+
+//the family id of the token without rotating it, e.g. for checking the CSRF token of the session before the refresh
+func FamilyOf(token string) (familyId string, err error) {
+	r, err := find(token)
+	if err != nil {
+		return ``, err
+	}
+	return r.FamilyId, nil
+}
+
+//revoke the token family of the given token, i.e. logout the session, and return the owner and the family id
+//revoking an invalid token is not an error, as the session is logged out anyway. Empty family id is returned in such case
+func Revoke(token string) (userId string, familyId string, err error) {
+	r, err := find(token)
+	if err == ErrInvalidToken {
+		return ``, ``, nil
+	}
+	if err != nil {
+		return ``, ``, err
+	}
+	return r.UserId, r.FamilyId, RevokeFamily(r.UserId, r.FamilyId)
+}
+
+//revoke the token family of the user by the family id
+func RevokeFamily(userId string, familyId string) error {
+	if err := redisClient.Del(familyKey(familyId)).Err(); err != nil {
+		return err
+	}
+	return redisClient.SRem(userKey(userId), familyId).Err()
+}
+
+//revoke all token families of the user, i.e. logout all sessions
+func RevokeAll(userId string) error {
+	familyIds, err := redisClient.SMembers(userKey(userId)).Result()
+	if err != nil {
+		return err
+	}
+	for _, familyId := range familyIds {
+		if err := redisClient.Del(familyKey(familyId)).Err(); err != nil {
+			return err
+		}
+	}
+	return redisClient.Del(userKey(userId)).Err()
+}
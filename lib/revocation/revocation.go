@@ -0,0 +1,188 @@
+//the jwt token cannot be revoked by itself, this module keeps the states for rejecting the revoked tokens
+//the states are cached in redis, thus verifying a token doesn't hit the database in most cases
+
+package revocation
+
+import (
+	"strconv"
+	"time"
+
+	"meow/lib/txhook"
+
+	"github.com/go-xorm/xorm"
+	redis "gopkg.in/redis.v3"
+)
+
+const (
+	//the cache is removed when the state changes, the short period is a safety net in case of the race condition
+	CACHE_PERIOD = time.Minute
+
+	//the token version of a deleted user, all tokens of such user are rejected
+	deletedUserVersion = -1
+)
+
+var (
+	db          *xorm.Engine
+	redisClient *redis.Client
+)
+
+func Init(database *xorm.Engine, client *redis.Client) {
+	db = database
+	redisClient = client
+}
+
+func tokenVersionKey(userId string) string {
+	return `token-version-` + userId
+}
+
+//check if the token version in the token is still the current token version of the user
+//the tokens of a deleted user are always rejected
+func IsTokenVersionValid(userId string, tokenVersion int) (bool, error) {
+	current, err := getTokenVersion(userId)
+	if err != nil {
+		return false, err
+	}
+	return current != deletedUserVersion && current == tokenVersion, nil
+}
+
+func getTokenVersion(userId string) (int, error) {
+	if v, err := redisClient.Get(tokenVersionKey(userId)).Int64(); err == nil {
+		return int(v), nil
+	} else if err != redis.Nil {
+		return 0, err
+	}
+
+	user := struct {
+		TokenVersion int
+	}{}
+	found, err := db.Table("users").Where("id = ?", userId).Cols("token_version").Get(&user)
+	if err != nil {
+		return 0, err
+	}
+	if found == false {
+		user.TokenVersion = deletedUserVersion
+	}
+
+	if err := redisClient.Set(tokenVersionKey(userId), strconv.Itoa(user.TokenVersion), CACHE_PERIOD).Err(); err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
+
+//increase the token version of the user, thus all tokens issued before are rejected
+//it should be called when the user logs out everywhere, changes the password, or is deleted
+//the cache is cleared again after the commit, as a concurrent request may cache the old version before the commit
+func IncreaseTokenVersion(session *xorm.Session, userId string) error {
+	if _, err := session.Exec("update users set token_version = token_version + 1 where id = ?", userId); err != nil {
+		return err
+	}
+	txhook.AfterCommit(session, func() error {
+		return ClearTokenVersionCache(userId)
+	})
+	return ClearTokenVersionCache(userId)
+}
+
+//remove the cached token version, thus the next verification reads the latest value from database
+func ClearTokenVersionCache(userId string) error {
+	return redisClient.Del(tokenVersionKey(userId)).Err()
+}
+
+func sessionKey(sessionId string) string {
+	return `session-valid-` + sessionId
+}
+
+//check if the login session is not yet revoked
+//the last seen time of the session is updated on the cache miss, thus it is accurate to the CACHE_PERIOD
+func IsSessionValid(sessionId string) (bool, error) {
+	if v, err := redisClient.Get(sessionKey(sessionId)).Result(); err == nil {
+		return v == `1`, nil
+	} else if err != redis.Nil {
+		return false, err
+	}
+
+	result, err := db.Exec("update user_sessions set last_seen_time = now() where id = ? and revoke_time is null", sessionId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	valid := `0`
+	if affected > 0 {
+		valid = `1`
+	}
+	if err := redisClient.Set(sessionKey(sessionId), valid, CACHE_PERIOD).Err(); err != nil {
+		return false, err
+	}
+	return valid == `1`, nil
+}
+
+//revoke the login session of the user, thus the access tokens of the session are rejected
+//false is returned if the session is not found or already revoked
+//the cache is cleared again after the commit, as a concurrent request may cache the session as valid before the commit
+func RevokeSession(session *xorm.Session, userId string, sessionId string) (bool, error) {
+	result, err := session.Exec("update user_sessions set revoke_time = now() where id = ? and user_id = ? and revoke_time is null", sessionId, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	txhook.AfterCommit(session, func() error {
+		return redisClient.Del(sessionKey(sessionId)).Err()
+	})
+	return affected > 0, redisClient.Del(sessionKey(sessionId)).Err()
+}
+
+//mark all login sessions of the user as revoked
+//the cached states are not cleared, as the access tokens are already rejected by the increased token version
+func RevokeAllSessions(session *xorm.Session, userId string) error {
+	_, err := session.Exec("update user_sessions set revoke_time = now() where user_id = ? and revoke_time is null", userId)
+	return err
+}
+
+//revoke all login sessions of the user except the given one, e.g. the session changing the password
+//the ids of the revoked sessions are returned, thus the caller can revoke their refresh tokens too
+func RevokeOtherSessions(session *xorm.Session, userId string, keepSessionId string) ([]string, error) {
+	sessions := []struct {
+		Id string
+	}{}
+	if err := session.Table("user_sessions").Where("user_id = ? and revoke_time is null", userId).Cols("id").Find(&sessions); err != nil {
+		return nil, err
+	}
+
+	revoked := []string{}
+	for _, s := range sessions {
+		if s.Id == keepSessionId {
+			continue
+		}
+		if _, err := RevokeSession(session, userId, s.Id); err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, s.Id)
+	}
+	return revoked, nil
+}
+
+func deniedTokenKey(tokenId string) string {
+	return `token-denied-` + tokenId
+}
+
+//reject the token by its id (the jti claim)
+//the entry is kept for ttl only, which should be long enough for the token to expire
+func DenyToken(tokenId string, ttl time.Duration) error {
+	return redisClient.Set(deniedTokenKey(tokenId), ``, ttl).Err()
+}
+
+//deny the token by its id, false is returned if it is already denied
+//it makes a token single-use, only one of the concurrent requests can deny it
+func UseToken(tokenId string, ttl time.Duration) (bool, error) {
+	return redisClient.SetNX(deniedTokenKey(tokenId), ``, ttl).Result()
+}
+
+func IsTokenDenied(tokenId string) (bool, error) {
+	return redisClient.Exists(deniedTokenKey(tokenId)).Result()
+}
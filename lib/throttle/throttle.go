@@ -0,0 +1,126 @@
+//counting the failed attempts in redis, e.g. the failed logins
+//once the failures exceed the allowed attempts, the subject is locked out with exponential backoff
+
+package throttle
+
+import (
+	"time"
+
+	redis "gopkg.in/redis.v3"
+)
+
+var (
+	redisClient *redis.Client
+)
+
+func Init(client *redis.Client) {
+	redisClient = client
+}
+
+type Policy struct {
+	//the failures allowed before the first lockout
+	MaxAttempts int
+	//the period of the first lockout, it is doubled for each further failure
+	LockoutPeriod    time.Duration
+	MaxLockoutPeriod time.Duration
+	//the failure count is reset if there is no failure within this period
+	Window time.Duration
+}
+
+func countKey(name string) string {
+	return `throttle-count-` + name
+}
+
+func lockKey(name string) string {
+	return `throttle-lock-` + name
+}
+
+//return the remaining lockout period, zero means the subject is not locked
+func LockedFor(name string) (time.Duration, error) {
+	ttl, err := redisClient.TTL(lockKey(name)).Result()
+	if err != nil {
+		return 0, err
+	}
+	//negative ttl means the key doesn't exist
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+//count an attempt before the credential is checked, thus the concurrent attempts cannot pass the limit together
+//allowed is false if the attempt is rejected, the lockout is the remaining period.
+//an allowed attempt with a lockout is the last one before the lockout, the subject is locked if it fails.
+//the successful attempt should be cleared by Reset or Forgive
+func Attempt(name string, p Policy) (allowed bool, lockout time.Duration, err error) {
+	if lockout, err := LockedFor(name); err != nil {
+		return false, 0, err
+	} else if lockout > 0 {
+		return false, lockout, nil
+	}
+
+	count, err := increase(name, p)
+	if err != nil {
+		return false, 0, err
+	}
+	if count <= int64(p.MaxAttempts) {
+		return true, 0, nil
+	}
+
+	//the lock is set before the credential is checked, only the request setting it can go on
+	lockout = lockoutPeriod(count, p)
+	if ok, err := redisClient.SetNX(lockKey(name), ``, lockout).Result(); err != nil {
+		return false, 0, err
+	} else if ok == false {
+		remaining, err := LockedFor(name)
+		return false, remaining, err
+	}
+	return true, lockout, nil
+}
+
+//take back an attempt which turned out to be successful, without clearing the failures before it
+//e.g. the attempts counted per client ip, thus an attacker owning one account cannot reset the counter by logging in
+func Forgive(name string) error {
+	count, err := redisClient.Decr(countKey(name)).Result()
+	if err != nil {
+		return err
+	}
+	//the count expired in between, the key created by DECR has no expiry
+	if count <= 0 {
+		return redisClient.Del(countKey(name)).Err()
+	}
+	return nil
+}
+
+func increase(name string, p Policy) (int64, error) {
+	count, err := redisClient.Incr(countKey(name)).Result()
+	if err != nil {
+		return 0, err
+	}
+	//the count must outlive the lockout, otherwise the backoff restarts after each lockout
+	window := p.Window
+	if window < p.MaxLockoutPeriod {
+		window = p.MaxLockoutPeriod
+	}
+	if err := redisClient.Expire(countKey(name), window).Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+//the lockout period is doubled for each count over the allowed attempts
+func lockoutPeriod(count int64, p Policy) time.Duration {
+	lockout := p.LockoutPeriod
+	for i := int64(p.MaxAttempts) + 1; i < count && lockout < p.MaxLockoutPeriod; i++ {
+		lockout = lockout * 2
+	}
+	if lockout > p.MaxLockoutPeriod {
+		lockout = p.MaxLockoutPeriod
+	}
+	return lockout
+}
+
+//clear the failures and the lockout, e.g. after a successful login, or unlocked by the admin
+func Reset(name string) error {
+	return redisClient.Del(countKey(name), lockKey(name)).Err()
+}
@@ -0,0 +1,100 @@
+//the time-based one-time password (RFC 6238), compatible with the authenticator apps
+//it uses HMAC-SHA1, 6 digits and 30 seconds period, which are the defaults of the apps
+
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "gopkg.in/redis.v3"
+)
+
+const (
+	PERIOD = 30 * time.Second
+	DIGITS = 6
+	//the codes of the adjacent time steps are also accepted, to tolerate the clock drift of the device
+	SKEW = 1
+
+	secretLength = 20
+)
+
+var (
+	redisClient *redis.Client
+	encoding    = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+//the redis is used for rejecting the reuse of a code
+func Init(client *redis.Client) {
+	redisClient = client
+}
+
+//generate a random secret, encoded in base32
+func NewSecret() (string, error) {
+	b := make([]byte, secretLength)
+	if _, err := rand.Read(b); err != nil {
+		return ``, err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+//the otpauth uri for enrolling the secret in the authenticator app, usually shown as QR code
+func Uri(issuer, accountName, secret string) string {
+	label := url.PathEscape(issuer) + `:` + url.PathEscape(accountName)
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", strconv.Itoa(DIGITS))
+	v.Set("period", strconv.Itoa(int(PERIOD/time.Second)))
+	return `otpauth://totp/` + label + `?` + v.Encode()
+}
+
+//check the code against the secret at the current time
+//each code can be used once only for each user, the subject is the key for the reuse detection, e.g. the userId
+func Verify(subject, secret, code string) (bool, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return false, err
+	}
+
+	step := time.Now().Unix() / int64(PERIOD/time.Second)
+	for i := int64(-SKEW); i <= SKEW; i++ {
+		if subtle.ConstantTimeCompare([]byte(generate(key, uint64(step+i))), []byte(code)) != 1 {
+			continue
+		}
+
+		//the key lives until the code is no longer accepted
+		usedKey := `totp-used-` + subject + `-` + strconv.FormatInt(step+i, 10)
+		return redisClient.SetNX(usedKey, ``, PERIOD*(2*SKEW+1)).Result()
+	}
+	return false, nil
+}
+
+//the HOTP algorithm (RFC 4226)
+func generate(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	//dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < DIGITS; i++ {
+		mod = mod * 10
+	}
+	return fmt.Sprintf("%0*d", DIGITS, value%mod)
+}
@@ -0,0 +1,47 @@
+//the actions deferred until the database transaction is committed, e.g. clearing the cache of the changed rows
+//the cache cleared inside the transaction can be filled again by a concurrent request, with the old value before the commit
+
+package txhook
+
+import (
+	"log"
+	"sync"
+
+	"github.com/go-xorm/xorm"
+)
+
+var (
+	lock  sync.Mutex
+	hooks = map[*xorm.Session][]func() error{}
+)
+
+//run f once the transaction of the session is committed, it is dropped if the transaction is rolled back
+func AfterCommit(session *xorm.Session, f func() error) {
+	lock.Lock()
+	defer lock.Unlock()
+	hooks[session] = append(hooks[session], f)
+}
+
+//it should be called right after the transaction is committed
+//the failures are logged only, as the data is already committed
+func Committed(session *xorm.Session) {
+	for _, f := range take(session) {
+		if err := f(); err != nil {
+			log.Println("Failed to run the action after the commit:", err)
+		}
+	}
+}
+
+//forget the actions of the session, it should be deferred once the session is created
+//it is harmless after Committed
+func Discard(session *xorm.Session) {
+	take(session)
+}
+
+func take(session *xorm.Session) []func() error {
+	lock.Lock()
+	defer lock.Unlock()
+	fs := hooks[session]
+	delete(hooks, session)
+	return fs
+}
@@ -97,3 +97,11 @@ func ValidateStructForUpdate(s interface{}, structFieldNames map[string]bool) er
 
 	return nil
 }
+
+//the validation errors of the input fields, keyed by the json field name
+//it is sent to the client as {"error": ..., "fields": {"password": ["...", ...]}}
+type FieldErrors map[string][]string
+
+func (e FieldErrors) Error() string {
+	return "The input is invalid."
+}
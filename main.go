@@ -3,33 +3,57 @@ package main
 import (
 	"crypto/rsa"
 	"fmt"
-	"io/ioutil"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
+	"syscall"
 	"time"
 
 	"log"
 
 	"meow/handler"
+	"meow/lib/apikey"
+	"meow/lib/audit"
 	"meow/lib/auth"
 	"meow/lib/config"
+	"meow/lib/cookie"
+	"meow/lib/export"
 	"meow/lib/httputil"
 	"meow/lib/lock"
+	"meow/lib/mail"
 	"meow/lib/middleware"
+	"meow/lib/mtls"
+	"meow/lib/oidc"
+	"meow/lib/password"
+	"meow/lib/policy"
+	"meow/lib/refresh"
+	"meow/lib/revocation"
+	"meow/lib/throttle"
+	"meow/lib/totp"
 	"meow/setting"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	xormCore "github.com/go-xorm/core"
 	"github.com/go-xorm/xorm"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 	redis "gopkg.in/redis.v3"
 )
 
 func main() {
-	showDevAuth()
+	//the admin command for the key rotation
+	if len(os.Args) > 1 && os.Args[1] == `rotate-key` {
+		rotateKey()
+		return
+	}
+
 	initDependency()
+	showDevAuth()
+	watchKeyReload()
+	go export.Run()
 
 	//in old go compiler, it is a must to enable multithread processing
 	runtime.GOMAXPROCS(runtime.NumCPU())
@@ -37,13 +61,53 @@ func main() {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/v1/auth", middleware.Plain(handler.Login)).Methods("POST")
+	router.HandleFunc("/v1/auth/refresh", middleware.Plain(handler.Refresh)).Methods("POST")
+	router.HandleFunc("/v1/auth/logout", middleware.Plain(handler.Logout)).Methods("POST")
+	router.HandleFunc("/v1/auth/logout-all", middleware.AuthAndTx(handler.LogoutAll, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/auth/mfa", middleware.Plain(handler.LoginMfa)).Methods("POST")
+	router.HandleFunc("/v1/auth/oidc/login", middleware.Plain(handler.OidcLogin)).Methods("GET")
+	router.HandleFunc("/v1/auth/oidc/callback", middleware.Plain(handler.OidcCallback)).Methods("GET")
+	router.HandleFunc("/v1/auth/oidc/token", middleware.Plain(handler.OidcToken)).Methods("POST")
+	router.HandleFunc("/v1/auth/totp", middleware.AuthAndTx(handler.TotpEnroll, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/auth/totp/confirm", middleware.AuthAndTx(handler.TotpConfirm, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/auth/totp", middleware.AuthAndTx(handler.TotpDisable, auth.SCOPE_ACCOUNT)).Methods("DELETE")
+	router.HandleFunc("/v1/auth/password-reset", middleware.Plain(handler.PasswordResetRequest)).Methods("POST")
+	router.HandleFunc("/v1/auth/password-reset/confirm", middleware.Plain(handler.PasswordResetConfirm)).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", middleware.Plain(handler.Jwks)).Methods("GET")
 
 	router.HandleFunc("/v1/user", middleware.Plain(handler.UserCreate)).Methods("POST")
+	router.HandleFunc("/v1/user/verify", middleware.Plain(handler.UserVerify)).Methods("POST")
+	router.HandleFunc("/v1/user/email/confirm", middleware.Plain(handler.UserEmailConfirm)).Methods("POST")
+	router.HandleFunc("/v1/user/verify/resend", middleware.AuthAndTx(handler.UserVerifyResend, auth.SCOPE_ACCOUNT)).Methods("POST")
+
+	//the key is returned once, thus the creation is not intercepted for the double post
+	router.HandleFunc("/v1/user/api-keys", middleware.AuthAndTx(handler.ApiKeyCreate, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/user/api-keys", middleware.Auth(handler.ApiKeyList, auth.SCOPE_ACCOUNT)).Methods("GET")
+	router.HandleFunc("/v1/user/api-keys/{apiKeyId}", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.ApiKeyDelete), auth.SCOPE_ACCOUNT)).Methods("DELETE")
 
-	router.HandleFunc("/v1/cats/{catId}", middleware.Auth(handler.CatGetOne)).Methods("GET")
-	router.HandleFunc("/v1/cats/{catId}", middleware.AuthAndTx(handler.CatUpdate)).Methods("PUT")
-	router.HandleFunc("/v1/cats/{catId}", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.CatDelete))).Methods("DELETE")
-	router.HandleFunc("/v1/cats", middleware.AuthAndTx(middleware.DoublePostIntercept(handler.CatCreate))).Methods("POST")
+	router.HandleFunc("/v1/user/sessions", middleware.Auth(handler.SessionList, auth.SCOPE_ACCOUNT)).Methods("GET")
+	router.HandleFunc("/v1/user/sessions/{sessionId}", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.SessionDelete), auth.SCOPE_ACCOUNT)).Methods("DELETE")
+
+	router.HandleFunc("/v1/auth/denylist/{tokenId}", middleware.Auth(handler.TokenDeny, auth.SCOPE_USER_ADMIN)).Methods("PUT")
+	//the user can access his own record only
+	router.HandleFunc("/v1/users/{userId}", middleware.Auth(handler.UserGetOne)).Methods("GET")
+	router.HandleFunc("/v1/users/{userId}", middleware.AuthAndTx(handler.UserUpdate, auth.SCOPE_ACCOUNT)).Methods("PUT")
+	router.HandleFunc("/v1/users/{userId}", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.UserDelete), auth.SCOPE_ACCOUNT)).Methods("DELETE")
+	router.HandleFunc("/v1/users/{userId}/email", middleware.AuthAndTx(handler.UserEmailChange, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/users/{userId}/password", middleware.AuthAndTx(handler.UserPasswordUpdate, auth.SCOPE_ACCOUNT)).Methods("PUT")
+	router.HandleFunc("/v1/users/{userId}/exports", middleware.Auth(handler.ExportCreate, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/users/{userId}/exports/{exportId}", middleware.Auth(handler.ExportGetOne, auth.SCOPE_ACCOUNT)).Methods("GET")
+	router.HandleFunc("/v1/users/{userId}/exports/{exportId}/archive", middleware.Auth(handler.ExportDownload, auth.SCOPE_ACCOUNT)).Methods("GET")
+	router.HandleFunc("/v1/users/{userId}/impersonation", middleware.Auth(handler.UserImpersonate, auth.SCOPE_USER_ADMIN, auth.SCOPE_ACCOUNT)).Methods("POST")
+	router.HandleFunc("/v1/users/{userId}/role", middleware.AuthAndTx(handler.UserRoleUpdate, auth.SCOPE_USER_ADMIN)).Methods("PUT")
+	router.HandleFunc("/v1/users/{userId}/lockout", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.LoginUnlock), auth.SCOPE_USER_ADMIN)).Methods("DELETE")
+
+	router.HandleFunc("/v1/cats/{catId}", middleware.Auth(handler.CatGetOne, auth.SCOPE_CAT_READ)).Methods("GET")
+	router.HandleFunc("/v1/cats/{catId}", middleware.AuthAndTx(handler.CatUpdate, auth.SCOPE_CAT_WRITE)).Methods("PUT")
+	router.HandleFunc("/v1/cats/{catId}", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.CatDelete), auth.SCOPE_CAT_WRITE)).Methods("DELETE")
+	router.HandleFunc("/v1/cats", middleware.AuthAndTx(middleware.DoublePostIntercept(handler.CatCreate), auth.SCOPE_CAT_WRITE)).Methods("POST")
+	router.HandleFunc("/v1/cats/{catId}/shares/{userId}", middleware.AuthAndTx(handler.CatShareCreate, auth.SCOPE_CAT_WRITE)).Methods("PUT")
+	router.HandleFunc("/v1/cats/{catId}/shares/{userId}", middleware.AuthAndTx(middleware.DoubleDeleteIntercept(handler.CatShareDelete), auth.SCOPE_CAT_WRITE)).Methods("DELETE")
 
 	http.Handle("/", router)
 	s := &http.Server{
@@ -51,6 +115,16 @@ func main() {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
+
+	//TLS mode, the internal services can authenticate by the client certificate
+	if certFile := config.GetStr(setting.TLS_CERT_FILE); certFile != `` {
+		tlsConfig, err := mtls.ServerTlsConfig(config.GetStr(setting.TLS_CLIENT_CA_FILE))
+		if err != nil {
+			log.Panic(err)
+		}
+		s.TLSConfig = tlsConfig
+		log.Fatal(s.ListenAndServeTLS(certFile, config.GetStr(setting.TLS_KEY_FILE)))
+	}
 	log.Fatal(s.ListenAndServe())
 }
 
@@ -92,49 +166,264 @@ func initDependency() {
 	redisClient := redis.NewClient(&redisOptions)
 
 	//load the RSA key from the file system, for the jwt auth
-	var err1 error
-	var currentKey *rsa.PrivateKey = nil
-	var oldKey *rsa.PrivateKey = nil
-
-	currentKeyBytes, _ := ioutil.ReadFile(config.GetStr(setting.JWT_RSA_KEY_LOCATION))
-	currentKey, err1 = jwt.ParseRSAPrivateKeyFromPEM(currentKeyBytes)
-	if err1 != nil {
-		log.Panic(err1)
-	}
-	if location := config.GetStr(setting.JWT_OLD_RSA_KEY_LOCATION); location != `` {
-		oldKeyBytes, _ := ioutil.ReadFile(location)
-		oldKey, err1 = jwt.ParseRSAPrivateKeyFromPEM(oldKeyBytes)
-		if err1 != nil {
-			log.Panic(err1)
-		}
+	currentKey, oldKey, err := loadKeys()
+	if err != nil {
+		log.Panic(err)
 	}
 	lifetime := time.Duration(config.GetInt(setting.JWT_TOKEN_LIFETIME)) * time.Minute
+	//auth.MaxTokenAge is derived from the jwt lifetime only, a longer impersonation token would outlive the denylist entry and the old key
+	if config.GetInt(setting.IMPERSONATION_TOKEN_LIFETIME) > config.GetInt(setting.JWT_TOKEN_LIFETIME) {
+		log.Panic(`Environmental variable [` + setting.IMPERSONATION_TOKEN_LIFETIME + `] should not be longer than [` + setting.JWT_TOKEN_LIFETIME + `]`)
+	}
+	auth.SetValidation(auth.Validation{
+		Issuer:    config.GetStr(setting.JWT_ISSUER),
+		Audience:  config.GetStr(setting.JWT_AUDIENCE),
+		ClockSkew: time.Duration(config.GetInt(setting.JWT_CLOCK_SKEW)) * time.Second,
+	})
 	auth.Init(currentKey, oldKey, lifetime)
+	auth.SetRenewPolicy(auth.RenewPolicy{
+		Fraction:           float64(config.GetInt(setting.JWT_RENEW_PERCENT)) / 100,
+		MaxSessionLifetime: time.Duration(config.GetInt(setting.JWT_MAX_SESSION_LIFETIME)) * time.Minute,
+	})
+
+	//add the redis dependency to refresh token module
+	refreshLifetime := time.Duration(config.GetInt(setting.REFRESH_TOKEN_LIFETIME)) * time.Minute
+	refresh.Init(redisClient, refreshLifetime)
 
-	httputil.Init(xormCore.SnakeMapper{})
+	httputil.Init(xormCore.SnakeMapper{}, config.GetStr(setting.CLIENT_IP_HEADER))
+	initCookie(refreshLifetime)
 
 	//add the db dependency to middleware module
 	middleware.Init(db, redisClient)
 
 	//add the redis dependency to lock module
 	lock.Init(redisClient)
+
+	//add the db and redis dependency to revocation module
+	revocation.Init(db, redisClient)
+
+	//add the db dependency to policy module
+	policy.Init(db)
+	apikey.Init(db)
+	audit.Init(db)
+	export.Init(db, config.GetStr(setting.EXPORT_DIR), time.Duration(config.GetInt(setting.EXPORT_ARCHIVE_LIFETIME))*time.Minute, handler.ExportBuilder(db))
+
+	principals, err := mtls.ParsePrincipals(config.GetStr(setting.SERVICE_PRINCIPALS))
+	if err != nil {
+		log.Panic(err)
+	}
+	mtls.Init(principals)
+
+	//add the redis dependency to throttle module
+	throttle.Init(redisClient)
+
+	//add the redis dependency to totp module
+	totp.Init(redisClient)
+
+	oidc.Init(oidc.Config{
+		Issuer:       config.GetStr(setting.OIDC_ISSUER),
+		ClientId:     config.GetStr(setting.OIDC_CLIENT_ID),
+		ClientSecret: config.GetStr(setting.OIDC_CLIENT_SECRET),
+		RedirectUrl:  config.GetStr(setting.OIDC_REDIRECT_URL),
+	}, redisClient)
+
+	lockoutPeriod := time.Duration(config.GetInt(setting.LOGIN_LOCKOUT_PERIOD)) * time.Second
+	maxLockoutPeriod := time.Duration(config.GetInt(setting.LOGIN_MAX_LOCKOUT_PERIOD)) * time.Second
+	handler.Init(handler.Config{
+		LoginEmailThrottle: throttle.Policy{
+			MaxAttempts:      config.GetInt(setting.LOGIN_MAX_ATTEMPTS),
+			LockoutPeriod:    lockoutPeriod,
+			MaxLockoutPeriod: maxLockoutPeriod,
+			Window:           maxLockoutPeriod,
+		},
+		LoginIpThrottle: throttle.Policy{
+			MaxAttempts:      config.GetInt(setting.LOGIN_MAX_ATTEMPTS_PER_IP),
+			LockoutPeriod:    lockoutPeriod,
+			MaxLockoutPeriod: maxLockoutPeriod,
+			Window:           maxLockoutPeriod,
+		},
+		PasswordResetUrl:           config.GetStr(setting.PASSWORD_RESET_URL),
+		PasswordResetTokenLifetime: time.Duration(config.GetInt(setting.PASSWORD_RESET_TOKEN_LIFETIME)) * time.Minute,
+		PasswordResetEmailThrottle: throttle.Policy{
+			MaxAttempts:      config.GetInt(setting.PASSWORD_RESET_MAX_REQUESTS),
+			LockoutPeriod:    lockoutPeriod,
+			MaxLockoutPeriod: maxLockoutPeriod,
+			Window:           maxLockoutPeriod,
+		},
+		PasswordResetIpThrottle: throttle.Policy{
+			MaxAttempts:      config.GetInt(setting.PASSWORD_RESET_MAX_REQUESTS_PER_IP),
+			LockoutPeriod:    lockoutPeriod,
+			MaxLockoutPeriod: maxLockoutPeriod,
+			Window:           maxLockoutPeriod,
+		},
+		EmailVerifyUrl:             config.GetStr(setting.EMAIL_VERIFY_URL),
+		EmailVerifyTokenLifetime:   time.Duration(config.GetInt(setting.EMAIL_VERIFY_TOKEN_LIFETIME)) * time.Minute,
+		EmailChangeUrl:             config.GetStr(setting.EMAIL_CHANGE_URL),
+		EmailChangeTokenLifetime:   time.Duration(config.GetInt(setting.EMAIL_CHANGE_TOKEN_LIFETIME)) * time.Minute,
+		OidcFrontendUrl:            config.GetStr(setting.OIDC_FRONTEND_URL),
+		TotpIssuer:                 config.GetStr(setting.TOTP_ISSUER),
+		ImpersonationTokenLifetime: time.Duration(config.GetInt(setting.IMPERSONATION_TOKEN_LIFETIME)) * time.Minute,
+		SudoWindow:                 time.Duration(config.GetInt(setting.SUDO_WINDOW)) * time.Minute,
+	})
+
+	initMail()
+	initPassword()
 }
 
-func showDevAuth() {
-	currentKeyBytes, _ := ioutil.ReadFile(config.GetStr(setting.JWT_RSA_KEY_LOCATION))
-	currentKey, err1 := jwt.ParseRSAPrivateKeyFromPEM(currentKeyBytes)
-	if err1 != nil {
-		log.Panic(err1)
+//the new passwords are hashed by the configured algorithm, the digests of the other algorithm are still accepted and upgraded on login
+func initPassword() {
+	//both hashers are validated, as the digests of the other algorithm are still verified
+	bcryptCost := config.GetInt(setting.BCRYPT_COST)
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		log.Panic(`Environmental variable [` + setting.BCRYPT_COST + `] should be between ` + strconv.Itoa(bcrypt.MinCost) + ` and ` + strconv.Itoa(bcrypt.MaxCost))
+	}
+	argon2Time, argon2Memory, argon2Threads := config.GetInt(setting.ARGON2_TIME), config.GetInt(setting.ARGON2_MEMORY), config.GetInt(setting.ARGON2_THREADS)
+	if argon2Time <= 0 || int64(argon2Time) > math.MaxUint32 {
+		log.Panic(`Environmental variable [` + setting.ARGON2_TIME + `] should be positive`)
+	}
+	if argon2Memory <= 0 || int64(argon2Memory) > math.MaxUint32 {
+		log.Panic(`Environmental variable [` + setting.ARGON2_MEMORY + `] should be positive`)
+	}
+	if argon2Threads <= 0 || argon2Threads > math.MaxUint8 {
+		log.Panic(`Environmental variable [` + setting.ARGON2_THREADS + `] should be between 1 and 255`)
+	}
+
+	bcryptHasher := password.BcryptHasher{Cost: bcryptCost}
+	argon2idHasher := password.Argon2idHasher{
+		Time:    uint32(argon2Time),
+		Memory:  uint32(argon2Memory),
+		Threads: uint8(argon2Threads),
 	}
+	switch config.GetStr(setting.PASSWORD_HASHER) {
+	case password.ALGORITHM_BCRYPT:
+		password.Init(bcryptHasher, argon2idHasher)
+	case password.ALGORITHM_ARGON2ID:
+		password.Init(argon2idHasher, bcryptHasher)
+	default:
+		log.Panic(`Environmental variable [` + setting.PASSWORD_HASHER + `] should be one of bcrypt/argon2id`)
+	}
+
+	password.SetPolicy(password.Policy{
+		MinLength:   config.GetInt(setting.PASSWORD_MIN_LENGTH),
+		MinScore:    config.GetInt(setting.PASSWORD_MIN_SCORE),
+		BreachedDir: config.GetStr(setting.BREACHED_PASSWORD_DIR),
+	})
+}
 
-	token := jwt.New(jwt.SigningMethodRS512)
+//the cookie mode for the browser, the tokens are sent in the cookies instead of the Authorization header
+func initCookie(refreshLifetime time.Duration) {
+	var sameSite http.SameSite
+	switch config.GetStr(setting.COOKIE_SAME_SITE) {
+	case `strict`:
+		sameSite = http.SameSiteStrictMode
+	case `lax`:
+		sameSite = http.SameSiteLaxMode
+	default:
+		log.Panic(`Environmental variable [` + setting.COOKIE_SAME_SITE + `] should be one of strict/lax`)
+	}
+	csrfSecret := config.GetStr(setting.CSRF_SECRET)
+	if len(csrfSecret) < 32 {
+		log.Panic(`Environmental variable [` + setting.CSRF_SECRET + `] should be at least 32 characters`)
+	}
+	cookie.Init(cookie.Config{
+		Secure:               config.GetBool(setting.COOKIE_SECURE),
+		SameSite:             sameSite,
+		Domain:               config.GetStr(setting.COOKIE_DOMAIN),
+		RefreshTokenLifetime: refreshLifetime,
+		CsrfSecret:           []byte(csrfSecret),
+	})
+}
+
+//load the current key and the old key from the key files, the old key is optional
+func loadKeys() (currentKey *rsa.PrivateKey, oldKey *rsa.PrivateKey, err error) {
+	if currentKey, err = auth.LoadKeyFile(config.GetStr(setting.JWT_RSA_KEY_LOCATION)); err != nil {
+		return nil, nil, err
+	}
+	if location := config.GetStr(setting.JWT_OLD_RSA_KEY_LOCATION); location != `` {
+		if oldKey, err = auth.LoadKeyFile(location); err != nil {
+			return nil, nil, err
+		}
+	}
+	return currentKey, oldKey, nil
+}
+
+//reload the key files on SIGHUP, e.g. after "meow rotate-key"
+//the new keys are swapped in only if both files are valid, otherwise the server keeps signing with the loaded key
+func watchKeyReload() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			currentKey, oldKey, err := loadKeys()
+			if err != nil {
+				log.Println("!!!!! FAILED TO RELOAD THE JWT KEYS, THE SERVER KEEPS USING THE KEY", auth.CurrentKeyId(), ":", err)
+				continue
+			}
+			auth.Reload(currentKey, oldKey)
+			log.Println("The JWT keys are reloaded, the current key is", auth.CurrentKeyId())
+		}
+	}()
+}
+
+//generate a new key at JWT_RSA_KEY_LOCATION, and move the current key to JWT_OLD_RSA_KEY_LOCATION
+//the running server picks up the new key by SIGHUP. Don't rotate again within JWT_TOKEN_LIFETIME, as the old key is overwritten
+func rotateKey() {
+	currentLocation := config.GetStr(setting.JWT_RSA_KEY_LOCATION)
+	oldLocation := config.GetStr(setting.JWT_OLD_RSA_KEY_LOCATION)
+	if oldLocation == `` {
+		log.Fatal(`Environmental variable [` + setting.JWT_OLD_RSA_KEY_LOCATION + `] is required for the key rotation`)
+	}
 
-	// Set some claims
-	token.Claims["userId"] = `eeee1df4-9fae-4e32-98c1-88f850a00001`
-	token.Claims["exp"] = time.Now().Add(time.Minute * 60 * 24 * 30).Unix()
+	//the current key must be valid, otherwise the tokens signed by it cannot be verified after the rotation
+	currentKey, err := auth.LoadKeyFile(currentLocation)
+	if err != nil {
+		log.Fatal(err)
+	}
+	newKey, err := auth.GenerateKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := auth.WriteKeyFile(oldLocation, currentKey); err != nil {
+		log.Fatal(err)
+	}
+	if err := auth.WriteKeyFile(currentLocation, newKey); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("The current key", auth.KeyId(&currentKey.PublicKey), "is moved to", oldLocation)
+	fmt.Println("The new key", auth.KeyId(&newKey.PublicKey), "is written to", currentLocation)
+	fmt.Println("Please send SIGHUP to the running servers, e.g. kill -HUP <pid>")
+}
+
+func initMail() {
+	var sender mail.Sender
+	switch config.GetStr(setting.MAIL_SENDER) {
+	case `smtp`:
+		sender = mail.SmtpSender{
+			Addr:     config.GetStr(setting.SMTP_ADDR),
+			Username: config.GetStr(setting.SMTP_USERNAME),
+			Password: config.GetStr(setting.SMTP_PASSWORD),
+		}
+	case `file`:
+		sender = mail.FileSender{Dir: config.GetStr(setting.MAIL_FILE_DIR)}
+	case `memory`:
+		sender = &mail.MemorySender{}
+	default:
+		log.Panic(`Environmental variable [` + setting.MAIL_SENDER + `] should be one of smtp/file/memory`)
+	}
+	mail.Init(sender, config.GetStr(setting.MAIL_FROM))
+}
+
+func showDevAuth() {
+	token, err := auth.Sign(auth.Claims{
+		UserId: `eeee1df4-9fae-4e32-98c1-88f850a00001`,
+		Role:   auth.ROLE_USER,
+		Scopes: auth.ScopesOf(auth.ROLE_USER),
+	})
+	if err != nil {
+		log.Panic(err)
+	}
 
-	// Sign and get the complete encoded token as a string
-	tokenString, _ := token.SignedString(currentKey)
 	fmt.Println("Please put the following string into http 'Authorization' header:")
-	fmt.Println(tokenString)
+	fmt.Println(token)
 }
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+//the API key of the machine client, only the digest of the key is stored
+type ApiKey struct {
+	Id     string `xorm:"pk" json:"id" validate:"fixed"`
+	UserId string `json:"userId" validate:"fixed"`
+
+	Name string `json:"name" validate:"required,max=100"`
+	//the leading characters of the key, thus the user can recognize the key in the list
+	KeyPrefix string `json:"keyPrefix" validate:"fixed"`
+	KeyDigest string `json:"-"`
+	//space separated
+	Scopes string `json:"scopes" validate:"fixed"`
+
+	ExpireTime time.Time `json:"expireTime" validate:"fixed"`
+	CreateTime time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c ApiKey) TableName() string {
+	return "api_keys"
+}
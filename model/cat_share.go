@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+//the cat is shared with the user, who can read the cat
+type CatShare struct {
+	CatId  string `xorm:"pk" json:"catId" validate:"fixed"`
+	UserId string `xorm:"pk" json:"userId" validate:"fixed"`
+
+	CreateTime time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c CatShare) TableName() string {
+	return "cat_shares"
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+//the personal data export requested by the user, the archive is built by the worker in lib/export
+type ExportJob struct {
+	Id     string `xorm:"pk" json:"id" validate:"fixed"`
+	UserId string `json:"userId" validate:"fixed"`
+
+	//one of pending/running/done/failed/expired
+	Status string `json:"status" validate:"fixed"`
+	//zero until the job is finished
+	FinishTime time.Time `json:"finishTime" validate:"fixed"`
+	//the archive can be downloaded until this time
+	ExpireTime time.Time `json:"expireTime" validate:"fixed"`
+
+	CreateTime time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c ExportJob) TableName() string {
+	return "export_jobs"
+}
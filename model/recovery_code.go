@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+//the single-use code for login when the TOTP device is lost, only the digest is stored
+type RecoveryCode struct {
+	Id     string `xorm:"pk" json:"id" validate:"fixed"`
+	UserId string `json:"userId" validate:"fixed"`
+
+	CodeDigest string `json:"-"`
+
+	CreateTime time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -7,6 +7,15 @@ type User struct {
 
 	Email          string `json:"email" validate:"fixed"`
 	PasswordDigest string `json:"-"`
+	//the user can read only, until the email is verified
+	EmailVerified bool `json:"emailVerified" validate:"fixed"`
+	//the secret of TOTP two-factor authentication, it takes effect only if TotpEnabled is true
+	TotpSecret  string `json:"-"`
+	TotpEnabled bool   `json:"totpEnabled" validate:"fixed"`
+	//increased to revoke all the issued tokens of the user
+	TokenVersion int `json:"-"`
+	//one of user/support/admin, which determines the scopes in the jwt token
+	Role string `json:"role" validate:"fixed"`
 
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+//the identity of the user at the external OpenID Connect provider
+type UserIdentity struct {
+	Id     string `xorm:"pk" json:"id" validate:"fixed"`
+	UserId string `json:"userId" validate:"fixed"`
+
+	//the issuer and subject identify the user at the provider
+	Issuer  string `json:"issuer" validate:"fixed"`
+	Subject string `json:"subject" validate:"fixed"`
+
+	CreateTime time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+//the login session of the user on a device, the id is also the family id of its refresh tokens
+type UserSession struct {
+	Id     string `xorm:"pk" json:"id" validate:"fixed"`
+	UserId string `json:"userId" validate:"fixed"`
+
+	//the name of the device given by the client, e.g. "Susan's iPhone"
+	DeviceLabel string `json:"deviceLabel" validate:"max=100"`
+	UserAgent   string `json:"userAgent" validate:"fixed"`
+	IpAddress   string `json:"ipAddress" validate:"fixed"`
+
+	LastSeenTime time.Time `json:"lastSeenTime" validate:"fixed"`
+	CreateTime   time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c UserSession) TableName() string {
+	return "user_sessions"
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+//the single-use token sent to the user by email, e.g. for resetting the password
+//only the digest of the token is stored, the use_time is set once the token is used
+type UserToken struct {
+	Id     string `xorm:"pk" json:"id" validate:"fixed"`
+	UserId string `json:"userId" validate:"fixed"`
+
+	Purpose     string    `json:"purpose" validate:"fixed"`
+	TokenDigest string    `json:"-"`
+	ExpireTime  time.Time `json:"expireTime" validate:"fixed"`
+	//the email to be confirmed by the token of EMAIL_CHANGE, empty for the other purposes
+	NewEmail string `json:"newEmail" validate:"fixed"`
+
+	CreateTime time.Time `xorm:"created" json:"createTime" validate:"zerotime"`
+}
+
+func (c UserToken) TableName() string {
+	return "user_tokens"
+}
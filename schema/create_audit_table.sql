@@ -13,3 +13,35 @@ create table audit.cats
 
 	CONSTRAINT "cats_audit_pk" PRIMARY KEY (id, action_time)
 );
+
+--the requests made by the admin as the impersonated user, inserted by audit.log_impersonation()
+create table audit.impersonations
+(
+	id bigserial,
+	action_time timestamp with time zone not null default current_timestamp,
+
+	actor_id uuid not null,
+	user_id uuid not null,
+
+	method character varying(10) not null,
+	path character varying(2000) not null,
+	ip_address character varying(100) not null,
+
+	CONSTRAINT "impersonations_audit_pk" PRIMARY KEY (id)
+);
+
+--the changes of the passwords, inserted by audit.log_password_change()
+create table audit.password_changes
+(
+	id bigserial,
+	action_time timestamp with time zone not null default current_timestamp,
+
+	user_id uuid not null,
+	--the login session making the change, null for the change by the reset token
+	session_id uuid,
+
+	verified_by character varying(20) not null,
+	ip_address character varying(100) not null,
+
+	CONSTRAINT "password_changes_audit_pk" PRIMARY KEY (id)
+);
@@ -44,3 +44,53 @@ CREATE TRIGGER audit_cats AFTER INSERT or update or delete
 ON cats FOR each row 
 execute procedure audit_cats_function();
 
+--meow_user can append the audit record by this function, without any privilege on the audit table
+CREATE OR REPLACE FUNCTION audit.log_impersonation(p_actor_id uuid, p_user_id uuid, p_method character varying, p_path character varying, p_ip_address character varying)
+returns void AS $$
+begin
+	insert into audit.impersonations(
+		action_time, actor_id, user_id, method, path, ip_address
+	)
+	values(
+		now(), p_actor_id, p_user_id, p_method, p_path, p_ip_address
+	);
+end;
+$$
+LANGUAGE plpgsql SECURITY DEFINER;
+
+--meow_user can append the audit record by this function, without any privilege on the audit table
+CREATE OR REPLACE FUNCTION audit.log_password_change(p_user_id uuid, p_session_id uuid, p_verified_by character varying, p_ip_address character varying)
+returns void AS $$
+begin
+	insert into audit.password_changes(
+		action_time, user_id, session_id, verified_by, ip_address
+	)
+	values(
+		now(), p_user_id, p_session_id, p_verified_by, p_ip_address
+	);
+end;
+$$
+LANGUAGE plpgsql SECURITY DEFINER;
+
+--the audit history of the user for the personal data export, meow_user can read it by this function only
+--the admin who impersonated the user is not included, as it is the personal data of the admin
+CREATE OR REPLACE FUNCTION audit.export_user_history(p_user_id uuid)
+returns json AS $$
+begin
+	return json_build_object(
+		'cats', (
+			select coalesce(json_agg(c order by c.action_time), '[]'::json) from audit.cats c
+			where c.user_id_old = p_user_id or c.user_id_new = p_user_id
+		),
+		'impersonations', (
+			select coalesce(json_agg(json_build_object('actionTime', i.action_time, 'method', i.method, 'path', i.path) order by i.action_time), '[]'::json)
+			from audit.impersonations i where i.user_id = p_user_id
+		),
+		'passwordChanges', (
+			select coalesce(json_agg(json_build_object('actionTime', p.action_time, 'sessionId', p.session_id, 'verifiedBy', p.verified_by, 'ipAddress', p.ip_address) order by p.action_time), '[]'::json)
+			from audit.password_changes p where p.user_id = p_user_id
+		)
+	);
+end;
+$$
+LANGUAGE plpgsql SECURITY DEFINER;
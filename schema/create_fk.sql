@@ -1 +1,9 @@
 ALTER TABLE cats ADD CONSTRAINT cats_fk1 FOREIGN KEY (user_id) REFERENCES users (id) MATCH FULL;
+ALTER TABLE cat_shares ADD CONSTRAINT cat_shares_fk1 FOREIGN KEY (cat_id) REFERENCES cats (id) ON DELETE CASCADE;
+ALTER TABLE cat_shares ADD CONSTRAINT cat_shares_fk2 FOREIGN KEY (user_id) REFERENCES users (id);
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_fk1 FOREIGN KEY (user_id) REFERENCES users (id);
+ALTER TABLE recovery_codes ADD CONSTRAINT recovery_codes_fk1 FOREIGN KEY (user_id) REFERENCES users (id);
+ALTER TABLE user_identities ADD CONSTRAINT user_identities_fk1 FOREIGN KEY (user_id) REFERENCES users (id);
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_fk1 FOREIGN KEY (user_id) REFERENCES users (id);
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_fk1 FOREIGN KEY (user_id) REFERENCES users (id);
+ALTER TABLE export_jobs ADD CONSTRAINT export_jobs_fk1 FOREIGN KEY (user_id) REFERENCES users (id);
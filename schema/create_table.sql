@@ -1,5 +1,12 @@
 --the script to remove all tables in the database
 /*
+DROP TABLE IF EXISTS export_jobs CASCADE;
+DROP TABLE IF EXISTS user_sessions CASCADE;
+DROP TABLE IF EXISTS api_keys CASCADE;
+DROP TABLE IF EXISTS user_identities CASCADE;
+DROP TABLE IF EXISTS recovery_codes CASCADE;
+DROP TABLE IF EXISTS user_tokens CASCADE;
+DROP TABLE IF EXISTS cat_shares CASCADE;
 DROP TABLE IF EXISTS cats CASCADE;
 DROP TABLE IF EXISTS users CASCADE;
 */
@@ -23,6 +30,11 @@ create table users
 
 	email character varying(200) not null,
 	password_digest character varying(1000) not null,
+	email_verified boolean not null default false,
+	totp_secret character varying(100) not null default '',
+	totp_enabled boolean not null default false,
+	token_version integer not null default 0,
+	role character varying(20) not null default 'user',
 
 	first_name character varying(255) null,
 	last_name character varying(255) null,
@@ -32,3 +44,113 @@ create table users
 	CONSTRAINT "users_pk" PRIMARY KEY (id)
 );
 ALTER TABLE users ADD CONSTRAINT users_u1 UNIQUE (email);
+
+create table cat_shares
+(
+	cat_id uuid,
+	user_id uuid,
+
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "cat_shares_pk" PRIMARY KEY (cat_id, user_id)
+);
+
+create table user_tokens
+(
+	id uuid,
+	user_id uuid not null,
+
+	--the usage of the token, e.g. PASSWORD_RESET
+	purpose character varying(50) not null,
+	token_digest character varying(100) not null,
+	expire_time timestamp with time zone not null,
+	--the email to be confirmed by the token of EMAIL_CHANGE
+	new_email character varying(200) null,
+	--null if the token is not yet used
+	use_time timestamp with time zone null,
+
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "user_tokens_pk" PRIMARY KEY (id)
+);
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_u1 UNIQUE (token_digest);
+
+create table recovery_codes
+(
+	id uuid,
+	user_id uuid not null,
+
+	--the code is deleted once it is used
+	code_digest character varying(100) not null,
+
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "recovery_codes_pk" PRIMARY KEY (id)
+);
+
+create table user_identities
+(
+	id uuid,
+	user_id uuid not null,
+
+	--the identity at the OpenID Connect provider
+	issuer character varying(500) not null,
+	subject character varying(255) not null,
+
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "user_identities_pk" PRIMARY KEY (id)
+);
+ALTER TABLE user_identities ADD CONSTRAINT user_identities_u1 UNIQUE (issuer, subject);
+
+create table api_keys
+(
+	id uuid,
+	user_id uuid not null,
+
+	name character varying(100) not null,
+	--the leading characters of the key, only the digest of the full key is stored
+	key_prefix character varying(20) not null,
+	key_digest character varying(100) not null,
+	--space separated, limited by the scopes of the user at the time of the request
+	scopes character varying(1000) not null,
+
+	expire_time timestamp with time zone not null,
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "api_keys_pk" PRIMARY KEY (id)
+);
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_u1 UNIQUE (key_digest);
+
+create table user_sessions
+(
+	--also the family id of the refresh tokens of the session
+	id uuid,
+	user_id uuid not null,
+
+	device_label character varying(100) not null,
+	user_agent character varying(500) not null,
+	ip_address character varying(100) not null,
+
+	--updated at most once per minute when the access token is used
+	last_seen_time timestamp with time zone not null,
+	--null until the session is logged out or revoked
+	revoke_time timestamp with time zone,
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "user_sessions_pk" PRIMARY KEY (id)
+);
+
+--the personal data export requested by the user, the archive is built by the worker in lib/export
+create table export_jobs
+(
+	id uuid,
+	user_id uuid not null,
+
+	--one of pending/running/done/failed/expired
+	status character varying(20) not null default 'pending',
+	--set when the worker claims the job, the job running for too long is claimed again
+	start_time timestamp with time zone,
+	finish_time timestamp with time zone,
+	--the archive is deleted after this time
+	expire_time timestamp with time zone,
+
+	create_time timestamp with time zone not null default current_timestamp,
+	CONSTRAINT "export_jobs_pk" PRIMARY KEY (id)
+);
+--a user has at most one unfinished job, even for concurrent requests
+CREATE UNIQUE INDEX export_jobs_u1 ON export_jobs (user_id) WHERE status in ('pending', 'running');
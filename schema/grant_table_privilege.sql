@@ -1,10 +1,34 @@
 /*for normal tables */
 GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE users                 to meow_user;
 GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE cats                  to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE cat_shares            to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE user_tokens           to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE recovery_codes        to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE user_identities       to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE api_keys              to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE user_sessions         to meow_user;
+GRANT SELECT, INSERT, UPDATE, DELETE, REFERENCES ON TABLE export_jobs           to meow_user;
 
 GRANT SELECT ON TABLE users                 to meow_readonly;
 GRANT SELECT ON TABLE cats                  to meow_readonly;
+GRANT SELECT ON TABLE cat_shares            to meow_readonly;
+GRANT SELECT ON TABLE user_tokens           to meow_readonly;
+GRANT SELECT ON TABLE recovery_codes        to meow_readonly;
+GRANT SELECT ON TABLE user_identities       to meow_readonly;
+GRANT SELECT ON TABLE api_keys              to meow_readonly;
+GRANT SELECT ON TABLE user_sessions         to meow_readonly;
+GRANT SELECT ON TABLE export_jobs           to meow_readonly;
 
 
 /*for audit tables */
 GRANT SELECT ON TABLE audit.cats            to meow_readonly;
+GRANT SELECT ON TABLE audit.impersonations  to meow_readonly;
+GRANT SELECT ON TABLE audit.password_changes to meow_readonly;
+
+/*for audit functions, meow_user appends the audit records by them only */
+REVOKE EXECUTE ON FUNCTION audit.log_impersonation(uuid, uuid, character varying, character varying, character varying) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION audit.log_impersonation(uuid, uuid, character varying, character varying, character varying) to meow_user;
+REVOKE EXECUTE ON FUNCTION audit.log_password_change(uuid, uuid, character varying, character varying) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION audit.log_password_change(uuid, uuid, character varying, character varying) to meow_user;
+REVOKE EXECUTE ON FUNCTION audit.export_user_history(uuid) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION audit.export_user_history(uuid) to meow_user;
@@ -1,7 +1,16 @@
 
-insert into users(id, email, password_digest, first_name, last_name)
+insert into users(id, email, password_digest, email_verified, first_name, last_name)
 values
-('eeee1df4-9fae-4e32-98c1-88f850a00001', 'Susan.Wong@abc.com', '$2a$10$Ba/oRmxnRx0D5/dZlMGqs.4rF2NC.pKbouzUKTHFaZ.we.1YFz5cO', 'Susan', 'Wong');
+('eeee1df4-9fae-4e32-98c1-88f850a00001', 'Susan.Wong@abc.com', '$2a$10$Ba/oRmxnRx0D5/dZlMGqs.4rF2NC.pKbouzUKTHFaZ.we.1YFz5cO', true, 'Susan', 'Wong');
+
+insert into users(id, email, password_digest, email_verified, first_name, last_name, role)
+values
+('eeee1df4-9fae-4e32-98c1-88f850a00002', 'Peter.Chan@abc.com', '$2a$10$Ba/oRmxnRx0D5/dZlMGqs.4rF2NC.pKbouzUKTHFaZ.we.1YFz5cO', true, 'Peter', 'Chan', 'admin');
+
+--the service principal of the client certificate "billing.internal", it cannot login by password
+insert into users(id, email, password_digest, email_verified, first_name, last_name, role)
+values
+('eeee1df4-9fae-4e32-98c1-88f850a00003', 'billing@service.internal', '', true, 'Billing', 'Service', 'service');
 
 
 
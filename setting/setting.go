@@ -17,9 +17,115 @@ const (
 	REDIS_ENDPOINT  string = `REDIS_ENDPOINT`
 	REDIS_POOL_SIZE string = `REDIS_POOL_SIZE`
 
-	JWT_RSA_KEY_LOCATION     string = `JWT_RSA_KEY_LOCATION`
+	JWT_RSA_KEY_LOCATION string = `JWT_RSA_KEY_LOCATION`
+	//the key before the last key rotation, it is used for verifying the tokens only. Empty string means no old key
 	JWT_OLD_RSA_KEY_LOCATION string = `JWT_OLD_RSA_KEY_LOCATION`
 
-	//measured in minute, the lifetime of the issued jwt token
+	//measured in minute, the lifetime of the issued jwt token. It should be short, as the token cannot be revoked
 	JWT_TOKEN_LIFETIME string = `JWT_TOKEN_LIFETIME`
+	//measured in minute, the session is logged out if the refresh token is not used within this period
+	REFRESH_TOKEN_LIFETIME string = `REFRESH_TOKEN_LIFETIME`
+	//the iss and aud claims of the jwt token, they should be different in each environment. Empty string means the claim is not used
+	JWT_ISSUER   string = `JWT_ISSUER`
+	JWT_AUDIENCE string = `JWT_AUDIENCE`
+	//measured in second, the tolerance of the clock difference between the servers
+	JWT_CLOCK_SKEW string = `JWT_CLOCK_SKEW`
+	//measured in percent of JWT_TOKEN_LIFETIME, the token is renewed by the server once it is older than this. 0 disables the renewal
+	JWT_RENEW_PERCENT string = `JWT_RENEW_PERCENT`
+	//measured in minute, the renewal never extends the token beyond the login time + this period. 0 means no limit
+	JWT_MAX_SESSION_LIFETIME string = `JWT_MAX_SESSION_LIFETIME`
+
+	//the certificate and the private key of the server in PEM format. Empty string means the server runs in plain http
+	TLS_CERT_FILE string = `TLS_CERT_FILE`
+	TLS_KEY_FILE  string = `TLS_KEY_FILE`
+	//the CA bundle for verifying the client certificates of the internal services. Empty string means no client certificate is requested
+	TLS_CLIENT_CA_FILE string = `TLS_CLIENT_CA_FILE`
+	//the client certificate subject (common name) => the service principal id in the users table, and its scopes
+	//e.g. "billing.internal=eeee1df4-9fae-4e32-98c1-88f850a00003/cat:read,cat:write;reporting.internal=..."
+	SERVICE_PRINCIPALS string = `SERVICE_PRINCIPALS`
+
+	//the http header storing the client ip set by the reverse proxy. Empty string means no reverse proxy
+	CLIENT_IP_HEADER string = `CLIENT_IP_HEADER`
+
+	//the cookies of the cookie mode for the browser. The secure flag should be false for the local development over http only
+	COOKIE_SECURE string = `COOKIE_SECURE`
+	//strict or lax
+	COOKIE_SAME_SITE string = `COOKIE_SAME_SITE`
+	//empty string means the host of the request
+	COOKIE_DOMAIN string = `COOKIE_DOMAIN`
+	//the key for deriving the CSRF tokens from the session ids, it should be a long random string
+	CSRF_SECRET string = `CSRF_SECRET`
+
+	//the failed logins allowed before the lockout, counted per email and per client ip
+	LOGIN_MAX_ATTEMPTS        string = `LOGIN_MAX_ATTEMPTS`
+	LOGIN_MAX_ATTEMPTS_PER_IP string = `LOGIN_MAX_ATTEMPTS_PER_IP`
+	//measured in second, the first lockout period, it is doubled for each further failure
+	LOGIN_LOCKOUT_PERIOD string = `LOGIN_LOCKOUT_PERIOD`
+	//measured in second, the upper bound of the lockout period
+	LOGIN_MAX_LOCKOUT_PERIOD string = `LOGIN_MAX_LOCKOUT_PERIOD`
+
+	//the web page for resetting the password, the token is appended as the query parameter "token"
+	PASSWORD_RESET_URL string = `PASSWORD_RESET_URL`
+	//measured in minute
+	PASSWORD_RESET_TOKEN_LIFETIME string = `PASSWORD_RESET_TOKEN_LIFETIME`
+	//the password reset requests allowed before the lockout, counted per email and per client ip. The lockout periods of the login apply
+	PASSWORD_RESET_MAX_REQUESTS        string = `PASSWORD_RESET_MAX_REQUESTS`
+	PASSWORD_RESET_MAX_REQUESTS_PER_IP string = `PASSWORD_RESET_MAX_REQUESTS_PER_IP`
+
+	//the web page for verifying the email, the token is appended as the query parameter "token"
+	EMAIL_VERIFY_URL string = `EMAIL_VERIFY_URL`
+	//measured in minute
+	EMAIL_VERIFY_TOKEN_LIFETIME string = `EMAIL_VERIFY_TOKEN_LIFETIME`
+
+	//the web page for confirming the new email, the token is appended as the query parameter "token"
+	EMAIL_CHANGE_URL string = `EMAIL_CHANGE_URL`
+	//measured in minute
+	EMAIL_CHANGE_TOKEN_LIFETIME string = `EMAIL_CHANGE_TOKEN_LIFETIME`
+
+	//the algorithm for hashing the new passwords, bcrypt or argon2id
+	PASSWORD_HASHER string = `PASSWORD_HASHER`
+	BCRYPT_COST     string = `BCRYPT_COST`
+	//the argon2id parameters, the memory is measured in KiB
+	ARGON2_TIME    string = `ARGON2_TIME`
+	ARGON2_MEMORY  string = `ARGON2_MEMORY`
+	ARGON2_THREADS string = `ARGON2_THREADS`
+
+	//the password policy, the score is from 0 (too guessable) to 4 (very unguessable)
+	PASSWORD_MIN_LENGTH string = `PASSWORD_MIN_LENGTH`
+	PASSWORD_MIN_SCORE  string = `PASSWORD_MIN_SCORE`
+	//the directory of the breached password list in the format of the HIBP range API. Empty string means the check is disabled
+	BREACHED_PASSWORD_DIR string = `BREACHED_PASSWORD_DIR`
+
+	//measured in minute, the lifetime of the token for the admin to impersonate the user. It must not be longer than JWT_TOKEN_LIFETIME, as the denylist and the key rotation keep the tokens up to JWT_TOKEN_LIFETIME only
+	IMPERSONATION_TOKEN_LIFETIME string = `IMPERSONATION_TOKEN_LIFETIME`
+
+	//measured in minute, the password can be changed without the current password within this period after the login
+	SUDO_WINDOW string = `SUDO_WINDOW`
+
+	//the directory storing the personal data export archives, it should be shared by all the servers
+	EXPORT_DIR string = `EXPORT_DIR`
+	//measured in minute, the archive can be downloaded within this period after it is built
+	EXPORT_ARCHIVE_LIFETIME string = `EXPORT_ARCHIVE_LIFETIME`
+
+	//the issuer shown in the authenticator app of TOTP
+	TOTP_ISSUER string = `TOTP_ISSUER`
+
+	//the OpenID Connect identity provider, empty issuer means the oidc login is disabled
+	OIDC_ISSUER        string = `OIDC_ISSUER`
+	OIDC_CLIENT_ID     string = `OIDC_CLIENT_ID`
+	OIDC_CLIENT_SECRET string = `OIDC_CLIENT_SECRET`
+	//the url of /v1/auth/oidc/callback, it must be registered at the provider
+	OIDC_REDIRECT_URL string = `OIDC_REDIRECT_URL`
+	//the web page the callback redirects to, it calls POST /v1/auth/oidc/token for the tokens, or shows the query parameter "error"
+	OIDC_FRONTEND_URL string = `OIDC_FRONTEND_URL`
+
+	//one of smtp/file/memory. file and memory are for development and testing
+	MAIL_SENDER string = `MAIL_SENDER`
+	MAIL_FROM   string = `MAIL_FROM`
+	//the directory for the file sender
+	MAIL_FILE_DIR string = `MAIL_FILE_DIR`
+	//host:port of the smtp server, the username can be empty if no authentication is required
+	SMTP_ADDR     string = `SMTP_ADDR`
+	SMTP_USERNAME string = `SMTP_USERNAME`
+	SMTP_PASSWORD string = `SMTP_PASSWORD`
 )
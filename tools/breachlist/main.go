@@ -0,0 +1,106 @@
+//build the breached password list for BREACHED_PASSWORD_DIR, in the format of the HIBP range API
+//the input is either the plain passwords, or the "<SHA-1>:<count>" lines of the downloaded HIBP list, one per line
+//the HIBP list is streamed, it must be the version ordered by hash, thus every range file is written once its prefix is passed
+//the plain passwords are collected in memory, as they are not ordered by hash
+//
+//usage: go run tools/breachlist/main.go -dir /opt/meow/breached < passwords.txt
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	dir    = flag.String("dir", "/opt/meow/breached", "the output directory, it must match BREACHED_PASSWORD_DIR of the server")
+	hashed = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+)
+
+func main() {
+	flag.Parse()
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	//the HIBP list is written while reading, the lines of the current prefix are buffered
+	prefix, lines, written := ``, []string{}, 0
+	//prefix => suffix => count, for the plain passwords only
+	ranges := map[string]map[string]string{}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == `` {
+			continue
+		}
+
+		if hashed.MatchString(line) == false {
+			if prefix != `` {
+				log.Fatal("The plain password is found in the HIBP list: ", line)
+			}
+			sum := sha1.Sum([]byte(line))
+			digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+			if ranges[digest[:5]] == nil {
+				ranges[digest[:5]] = map[string]string{}
+			}
+			ranges[digest[:5]][digest[5:]] = `1`
+			continue
+		}
+		if len(ranges) > 0 {
+			log.Fatal("The SHA-1 line is found in the plain passwords: ", line)
+		}
+
+		parts := strings.SplitN(line, `:`, 2)
+		digest, count := strings.ToUpper(parts[0]), `1`
+		if len(parts) == 2 {
+			count = parts[1]
+		}
+		if digest[:5] != prefix {
+			//a prefix seen before would overwrite its range file
+			if digest[:5] < prefix {
+				log.Fatal("The HIBP list is not ordered by hash, at line: ", line)
+			}
+			if prefix != `` {
+				writeRange(prefix, lines)
+				written++
+			}
+			prefix, lines = digest[:5], lines[:0]
+		}
+		lines = append(lines, digest[5:]+`:`+count)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	if prefix != `` {
+		writeRange(prefix, lines)
+		written++
+	}
+
+	for prefix, suffixes := range ranges {
+		lines := []string{}
+		for suffix, count := range suffixes {
+			lines = append(lines, suffix+`:`+count)
+		}
+		sort.Strings(lines)
+		writeRange(prefix, lines)
+		written++
+	}
+	fmt.Println("Wrote", written, "range files to", *dir)
+}
+
+func writeRange(prefix string, lines []string) {
+	if err := ioutil.WriteFile(filepath.Join(*dir, prefix), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
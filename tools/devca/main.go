@@ -0,0 +1,113 @@
+//generate a local CA, the server certificate, and the client certificates of the internal services for the development
+//
+//usage: go run tools/devca/main.go -dir /opt/meow/tls -clients billing.internal,reporting.internal
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	dir     = flag.String("dir", "/opt/meow/tls", "the output directory")
+	clients = flag.String("clients", "billing.internal", "the common names of the client certificates, separated by comma")
+)
+
+type keyPair struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func main() {
+	flag.Parse()
+
+	ca, err := generate(`Meow Dev CA`, nil, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, err := generate(`localhost`, ca, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	save(filepath.Join(*dir, `ca`), ca)
+	save(filepath.Join(*dir, `server`), server)
+	for _, name := range strings.Split(*clients, `,`) {
+		client, err := generate(name, ca, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		save(filepath.Join(*dir, name), client)
+	}
+	fmt.Println("The certificates are written to", *dir)
+}
+
+//generate a certificate signed by the parent, or a self-signed CA if parent is nil
+func generate(commonName string, parent *keyPair, isCa bool) (*keyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{`Meow Dev`}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCa {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.ExtKeyUsage = nil
+	} else {
+		template.DNSNames = []string{commonName}
+		template.IPAddresses = []net.IP{net.ParseIP(`127.0.0.1`)}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &keyPair{cert: cert, key: key}, nil
+}
+
+func save(prefix string, p *keyPair) {
+	certPem := pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: p.cert.Raw})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: `RSA PRIVATE KEY`, Bytes: x509.MarshalPKCS1PrivateKey(p.key)})
+	if err := ioutil.WriteFile(prefix+`.crt`, certPem, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(prefix+`.key`, keyPem, 0600); err != nil {
+		log.Fatal(err)
+	}
+}
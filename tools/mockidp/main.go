@@ -0,0 +1,34 @@
+//serve the mock OpenID Connect identity provider in lib/oidc/mockidp, for the manual test of the oidc login
+//it approves every login request immediately, as the user given by the login_hint parameter or the -email flag
+//
+//usage: go run tools/mockidp/main.go -addr :9090 -issuer http://localhost:9090
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"meow/lib/oidc/mockidp"
+)
+
+var (
+	addr         = flag.String("addr", ":9090", "the listening address")
+	issuer       = flag.String("issuer", "http://localhost:9090", "the issuer, it must match OIDC_ISSUER of the server")
+	clientId     = flag.String("client-id", "meow", "the client id, it must match OIDC_CLIENT_ID of the server")
+	clientSecret = flag.String("client-secret", "meow_secret", "the client secret, it must match OIDC_CLIENT_SECRET of the server")
+	defaultEmail = flag.String("email", "mock.user@abc.com", "the email of the user, if login_hint is not given")
+)
+
+func main() {
+	flag.Parse()
+
+	provider, err := mockidp.New(*issuer, *clientId, *clientSecret, *defaultEmail)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	log.Println("The mock identity provider is listening on " + *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider.Handler()))
+}